@@ -0,0 +1,88 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package checksum combines the CRC-32 and Adler-32 checksums of adjacent
+// pieces of data, like crc32_combine and adler32_combine in zlib.
+//
+// This lets the pieces of a large input be checksummed in parallel, for
+// example by the goroutines compressing them, and the checksum of the whole
+// be computed from theirs, as needed for the gzip and zip CRC-32 and the
+// zlib Adler-32 trailers:
+//
+//	crc := crc32.ChecksumIEEE(a)
+//	crc = checksum.CombineCRC32(crc32.IEEE, crc, crc32.ChecksumIEEE(b), int64(len(b)))
+//	// crc == crc32.ChecksumIEEE(append(a, b...))
+package checksum
+
+// CombineCRC32 returns the CRC-32 of the concatenation of two pieces of
+// data, given the CRC-32 of the first piece, crc1, the CRC-32 of the
+// second piece, crc2, and the length of the second piece, len2, which must
+// not be negative. poly is the polynomial in reversed notation, as the
+// constants of hash/crc32, such as crc32.IEEE and crc32.Castagnoli.
+//
+// It takes time proportional to the logarithm of len2.
+func CombineCRC32(poly, crc1, crc2 uint32, len2 int64) uint32 {
+	// Appending len2 zero bytes to the first piece multiplies its CRC by
+	// x^(8*len2) modulo the polynomial. The second piece then adds its own.
+	p := uint32(1) << 31 // x^0
+	x := uint32(1) << 23 // x^8
+	for n := len2; n > 0; n >>= 1 {
+		if n&1 != 0 {
+			p = multModP(x, p, poly)
+		}
+		x = multModP(x, x, poly)
+	}
+	return multModP(p, crc1, poly) ^ crc2
+}
+
+// multModP returns a(x) multiplied by b(x) modulo p(x), where the
+// polynomials are in reversed bit order: the highest bit is the
+// coefficient of x^0.
+func multModP(a, b, poly uint32) uint32 {
+	var p uint32
+	for m := uint32(1) << 31; m != 0 && a != 0; m >>= 1 {
+		if a&m != 0 {
+			p ^= b
+			a ^= m
+		}
+		if b&1 != 0 {
+			b = b>>1 ^ poly
+		} else {
+			b >>= 1
+		}
+	}
+	return p
+}
+
+// adlerBase is the modulus of Adler-32.
+const adlerBase = 65521
+
+// CombineAdler32 returns the Adler-32 of the concatenation of two pieces
+// of data, given the Adler-32 of the first piece, adler1, the Adler-32 of
+// the second piece, adler2, and the length of the second piece, len2, which
+// must not be negative.
+func CombineAdler32(adler1, adler2 uint32, len2 int64) uint32 {
+	// The low half of an Adler-32 is 1 plus the sum of the bytes, and the
+	// high half is the sum of the low half after each byte. Every byte of
+	// the second piece adds the sum of the first piece, minus its initial 1,
+	// to the high half.
+	rem := uint32(len2 % adlerBase)
+	sum1 := adler1 & 0xffff
+	sum2 := rem * sum1 % adlerBase
+	sum1 += adler2&0xffff + adlerBase - 1
+	sum2 += adler1>>16 + adler2>>16 + adlerBase - rem
+	if sum1 >= adlerBase {
+		sum1 -= adlerBase
+	}
+	if sum1 >= adlerBase {
+		sum1 -= adlerBase
+	}
+	if sum2 >= adlerBase<<1 {
+		sum2 -= adlerBase << 1
+	}
+	if sum2 >= adlerBase {
+		sum2 -= adlerBase
+	}
+	return sum1 | sum2<<16
+}
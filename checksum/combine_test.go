@@ -0,0 +1,77 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package checksum
+
+import (
+	"hash/adler32"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, 300000)
+	rng.Read(data)
+	// Long runs of 0xff push the Adler-32 sums to their limits.
+	for i := 100000; i < 200000; i++ {
+		data[i] = 0xff
+	}
+
+	splits := []int{0, 1, 2, 100, adlerBase - 1, adlerBase, adlerBase + 1, 150000, len(data) - 1, len(data)}
+	for i := 0; i < 50; i++ {
+		splits = append(splits, rng.Intn(len(data)+1))
+	}
+	for _, poly := range []uint32{crc32.IEEE, crc32.Castagnoli, crc32.Koopman} {
+		tab := crc32.MakeTable(poly)
+		want := crc32.Checksum(data, tab)
+		for _, n := range splits {
+			a, b := data[:n], data[n:]
+			got := CombineCRC32(poly, crc32.Checksum(a, tab), crc32.Checksum(b, tab), int64(len(b)))
+			if got != want {
+				t.Errorf("poly %#x, split at %d: got %#x, want %#x", poly, n, got, want)
+			}
+		}
+	}
+
+	want := adler32.Checksum(data)
+	for _, n := range splits {
+		a, b := data[:n], data[n:]
+		got := CombineAdler32(adler32.Checksum(a), adler32.Checksum(b), int64(len(b)))
+		if got != want {
+			t.Errorf("Adler-32, split at %d: got %#x, want %#x", n, got, want)
+		}
+	}
+}
+
+func TestCombineMany(t *testing.T) {
+	// Combine the checksums of many pieces in order, as a parallel writer
+	// would.
+	rng := rand.New(rand.NewSource(2))
+	data := make([]byte, 1<<20)
+	rng.Read(data)
+	crc, adler := crc32.ChecksumIEEE(nil), adler32.Checksum(nil)
+	for p := data; len(p) > 0; {
+		n := rng.Intn(70000)
+		if n > len(p) {
+			n = len(p)
+		}
+		crc = CombineCRC32(crc32.IEEE, crc, crc32.ChecksumIEEE(p[:n]), int64(n))
+		adler = CombineAdler32(adler, adler32.Checksum(p[:n]), int64(n))
+		p = p[n:]
+	}
+	if want := crc32.ChecksumIEEE(data); crc != want {
+		t.Errorf("CRC-32: got %#x, want %#x", crc, want)
+	}
+	if want := adler32.Checksum(data); adler != want {
+		t.Errorf("Adler-32: got %#x, want %#x", adler, want)
+	}
+}
+
+func BenchmarkCombineCRC32(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		CombineCRC32(crc32.IEEE, 0x12345678, 0x9abcdef0, 1<<30)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package detect decompresses streams whose format is not known in
+// advance, such as HTTP bodies labeled "deflate", which may be raw deflate
+// or zlib wrapped, or logs received in mixed encodings.
+//
+// NewReader looks at the first bytes of the stream, and returns a reader
+// from the gzip, zlib, snappy or flate package accordingly.
+package detect
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zlib"
+)
+
+// Format is a compressed stream format.
+type Format int
+
+const (
+	// Deflate is raw deflate data, as specified in RFC 1951. As it has no
+	// header, it is assumed when no other format matches.
+	Deflate Format = iota
+	// Zlib is zlib format data, as specified in RFC 1950.
+	Zlib
+	// Gzip is gzip format data, as specified in RFC 1952.
+	Gzip
+	// Snappy is the snappy framing format.
+	Snappy
+)
+
+var formatNames = [...]string{
+	Deflate: "deflate",
+	Zlib:    "zlib",
+	Gzip:    "gzip",
+	Snappy:  "snappy",
+}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return "unknown"
+	}
+	return formatNames[f]
+}
+
+// snappyMagic is the stream identifier chunk that starts snappy streams.
+const snappyMagic = "\xff\x06\x00\x00sNaPpY"
+
+// PeekLen is the number of bytes Detect needs to tell all formats apart.
+const PeekLen = len(snappyMagic)
+
+// Detect returns the format of a stream starting with b, which should hold
+// PeekLen bytes, or all of the stream if it is shorter.
+func Detect(b []byte) Format {
+	switch {
+	case len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b:
+		return Gzip
+	case len(b) >= len(snappyMagic) && string(b[:len(snappyMagic)]) == snappyMagic:
+		return Snappy
+	case len(b) >= 2 && isZlibHeader(b[0], b[1]):
+		return Zlib
+	}
+	return Deflate
+}
+
+// isZlibHeader reports whether cmf and flg are a valid zlib header: the
+// deflate method with a window of at most 32KB, and a check sum that is a
+// multiple of 31 (RFC 1950 section 2.2). A raw deflate stream could only
+// start with those bytes if it starts with a stored block with nonzero
+// padding bits, which encoders do not write.
+func isZlibHeader(cmf, flg byte) bool {
+	return cmf&0x0f == 8 && cmf>>4 <= 7 && (uint(cmf)<<8|uint(flg))%31 == 0
+}
+
+// NewReader returns a ReadCloser that decompresses r, and the format it
+// detected from the first bytes of r. As it needs to look ahead, it reads
+// r through a bufio.Reader.
+//
+// Zlib streams with a preset dictionary fail with zlib.ErrDictionary.
+// Calling Close does not close r. An empty stream is an error.
+func NewReader(r io.Reader) (io.ReadCloser, Format, error) {
+	br := bufio.NewReader(r)
+	b, err := br.Peek(PeekLen)
+	if len(b) == 0 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, Deflate, err
+	}
+	f := Detect(b)
+	switch f {
+	case Gzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, f, err
+		}
+		return zr, f, nil
+	case Zlib:
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, f, err
+		}
+		return zr, f, nil
+	case Snappy:
+		return snappy.NewReader(br), f, nil
+	}
+	return flate.NewReader(br), f, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package detect
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zlib"
+)
+
+func TestNewReader(t *testing.T) {
+	data := []byte(strings.Repeat("hello, world\n", 100))
+	compress := func(f Format, level int) []byte {
+		var b bytes.Buffer
+		var w io.WriteCloser
+		switch f {
+		case Deflate:
+			w, _ = flate.NewWriter(&b, level)
+		case Zlib:
+			w, _ = zlib.NewWriterLevel(&b, level)
+		case Gzip:
+			w, _ = gzip.NewWriterLevel(&b, level)
+		case Snappy:
+			w = snappy.NewBufferedWriter(&b)
+		}
+		w.Write(data)
+		w.Close()
+		return b.Bytes()
+	}
+
+	for _, f := range []Format{Deflate, Zlib, Gzip, Snappy} {
+		for _, level := range []int{flate.NoCompression, flate.BestSpeed, flate.DefaultCompression, flate.BestCompression, flate.ConstantCompression} {
+			r, got, err := NewReader(bytes.NewReader(compress(f, level)))
+			if err != nil {
+				t.Fatalf("%v, level %d: %v", f, level, err)
+			}
+			if got != f {
+				t.Errorf("level %d: got format %v, want %v", level, got, f)
+			}
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%v, level %d: %v", f, level, err)
+			}
+			if !bytes.Equal(b, data) {
+				t.Errorf("%v, level %d: output differs", f, level)
+			}
+			if err := r.Close(); err != nil {
+				t.Errorf("%v, level %d: Close: %v", f, level, err)
+			}
+		}
+	}
+
+	// An empty raw deflate stream is shorter than PeekLen.
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestSpeed)
+	w.Close()
+	if r, f, err := NewReader(&b); err != nil || f != Deflate {
+		t.Errorf("empty deflate stream: got %v, %v", f, err)
+	} else if n, err := io.Copy(ioutil.Discard, r); n != 0 || err != nil {
+		t.Errorf("empty deflate stream: got %d bytes, %v", n, err)
+	}
+
+	if _, _, err := NewReader(bytes.NewReader(nil)); err != io.ErrUnexpectedEOF {
+		t.Errorf("empty input: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, f, err := NewReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x08})); err == nil || f != Gzip {
+		t.Errorf("truncated gzip header: got %v, %v", f, err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		b    string
+		want Format
+	}{
+		{"", Deflate},
+		{"\x1f", Deflate},
+		{"\x1f\x8b", Gzip},
+		{"\x78\x9c", Zlib},
+		{"\x78\x01", Zlib},
+		{"\x78\xda", Zlib},
+		{"\x78\xbb", Zlib},
+		{"\x48\x0d", Zlib},
+		{"\x88\x98", Deflate}, // window too large
+		{"\x78\x9d", Deflate}, // bad check
+		{"\xff\x06\x00\x00sNaPpY", Snappy},
+		{"\xff\x06\x00\x00sNaPp", Deflate},
+	} {
+		if got := Detect([]byte(tc.b)); got != tc.want {
+			t.Errorf("%q: got %v, want %v", tc.b, got, tc.want)
+		}
+	}
+	if s := Format(10).String(); s != "unknown" {
+		t.Errorf("got %q, want %q", s, "unknown")
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dict builds preset dictionaries for flate and zlib from a corpus
+// of sample messages.
+//
+// A preset dictionary is data the compressor and the decompressor both
+// assume precedes the message, so that even the first bytes of a short
+// message can be encoded as matches. Build selects the substrings shared by
+// the most samples, and Evaluate reports how much they help:
+//
+//	d, err := dict.Build(samples, nil)
+//	...
+//	w, err := flate.NewWriterDict(dst, flate.DefaultCompression, d)
+//	...
+//	r := flate.NewReaderDict(src, d)
+//
+// The same dictionary works with zlib.NewWriterLevelDict and
+// zlib.NewReaderDict.
+package dict
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// DefaultSize is the default dictionary size: the deflate window, as
+	// matches can only reach back that far.
+	DefaultSize = 32 << 10
+
+	// DefaultSegmentLen is the default length of the substrings that make
+	// up the dictionary.
+	DefaultSegmentLen = 32
+
+	// dmerLen is the length of the substrings that are counted in the
+	// samples. Segments are scored by the dmers they hold.
+	dmerLen = 8
+)
+
+var errNoSamples = errors.New("dict: no samples of at least 8 bytes")
+
+// Options for Build. A nil *Options uses the defaults.
+type Options struct {
+	// Size is the maximum size of the dictionary. If 0, DefaultSize is
+	// used.
+	Size int
+
+	// SegmentLen is the length of the substrings the dictionary is built
+	// from. Longer segments suit samples that share long runs of data.
+	// If 0, DefaultSegmentLen is used.
+	SegmentLen int
+}
+
+// Build returns a dictionary for compressing messages like samples.
+//
+// It splits the concatenated samples into epochs, and takes from each in
+// turn the segment that covers the most 8 byte substrings (dmers) not yet
+// covered by the dictionary, weighing each dmer by the number of samples it
+// occurs in. The first segments taken are the most useful, so they are put
+// at the end of the dictionary, closest to the data, where matches are
+// cheapest to encode and are not pushed out of the window by the message
+// itself.
+//
+// It returns an error if no sample is long enough to hold a dmer.
+func Build(samples [][]byte, o *Options) ([]byte, error) {
+	size, k := DefaultSize, DefaultSegmentLen
+	if o != nil {
+		if o.Size > 0 {
+			size = o.Size
+		}
+		if o.SegmentLen > 0 {
+			k = o.SegmentLen
+		}
+	}
+	if k < dmerLen {
+		k = dmerLen
+	}
+
+	// Count the samples each dmer occurs in, and the positions in the
+	// corpus where a segment can start. A segment stays in one sample.
+	var corpus []byte
+	var ends []int // end of the sample of each position
+	freq := make(map[uint64]int)
+	seen := make(map[uint64]bool)
+	for _, s := range samples {
+		if len(s) < dmerLen {
+			continue
+		}
+		start := len(corpus)
+		corpus = append(corpus, s...)
+		for range s {
+			ends = append(ends, start+len(s))
+		}
+		for d := range seen {
+			delete(seen, d)
+		}
+		for i := 0; i+dmerLen <= len(s); i++ {
+			d := dmer(s, i)
+			if !seen[d] {
+				seen[d] = true
+				freq[d]++
+			}
+		}
+	}
+	if len(corpus) == 0 {
+		return nil, errNoSamples
+	}
+
+	epochs := size / k
+	if epochs < 1 {
+		epochs = 1
+	}
+	epochLen := len(corpus) / epochs
+	if epochLen < k {
+		epochLen = k
+		epochs = (len(corpus) + k - 1) / k
+	}
+
+	var segments [][]byte
+	total := 0
+	for total < size {
+		found := false
+		for e := 0; e < epochs && total < size; e++ {
+			start := e * epochLen
+			end := start + epochLen
+			if e == epochs-1 || end > len(corpus) {
+				end = len(corpus)
+			}
+			seg := bestSegment(corpus, ends, freq, start, end, k)
+			if seg == nil {
+				continue
+			}
+			found = true
+			if total+len(seg) > size {
+				seg = seg[len(seg)-(size-total):]
+			}
+			// Its dmers are covered now.
+			for i := 0; i+dmerLen <= len(seg); i++ {
+				delete(freq, dmer(seg, i))
+			}
+			segments = append(segments, seg)
+			total += len(seg)
+		}
+		if !found {
+			break
+		}
+	}
+
+	dict := make([]byte, 0, total)
+	for i := len(segments) - 1; i >= 0; i-- {
+		dict = append(dict, segments[i]...)
+	}
+	return dict, nil
+}
+
+// bestSegment returns the segment of up to k bytes starting in
+// corpus[start:end] with the highest sum of dmer frequencies, counting each
+// dmer once, or nil if no segment has a dmer left.
+func bestSegment(corpus []byte, ends []int, freq map[uint64]int, start, end, k int) []byte {
+	bestScore, bestPos, bestEnd := 0, 0, 0
+	// The window holds the dmers starting at [pos, pos+k-dmerLen], and
+	// counts the number of times each occurs there.
+	counts := make(map[uint64]int)
+	score := 0
+	add := func(i int) {
+		d := dmer(corpus, i)
+		if counts[d]++; counts[d] == 1 {
+			score += freq[d]
+		}
+	}
+	remove := func(i int) {
+		d := dmer(corpus, i)
+		if counts[d]--; counts[d] == 0 {
+			delete(counts, d)
+			score -= freq[d]
+		}
+	}
+
+	for pos := start; pos < end; {
+		// Slide the window over the rest of the sample, up to end.
+		sampleEnd := ends[pos]
+		last := pos // next dmer to add
+		for ; pos < end && pos+dmerLen <= sampleEnd; pos++ {
+			for ; last+dmerLen <= sampleEnd && last <= pos+k-dmerLen; last++ {
+				add(last)
+			}
+			if score > bestScore {
+				bestScore, bestPos, bestEnd = score, pos, pos+k
+				if bestEnd > sampleEnd {
+					bestEnd = sampleEnd
+				}
+			}
+			remove(pos)
+		}
+		for d := range counts {
+			delete(counts, d)
+		}
+		score = 0
+		if pos < sampleEnd {
+			pos = sampleEnd
+		}
+	}
+	if bestScore == 0 {
+		return nil
+	}
+	return corpus[bestPos:bestEnd:bestEnd]
+}
+
+func dmer(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dict
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zlib"
+)
+
+// payloads returns n JSON messages typical of a small API.
+func payloads(rng *rand.Rand, n int) [][]byte {
+	var out [][]byte
+	for i := 0; i < n; i++ {
+		out = append(out, []byte(fmt.Sprintf(`{"status":"ok","request_id":"%08x","data":{"account":{"id":%d,`+
+			`"display_name":"customer %d","plan":"%s","created_at":"2016-%02d-%02dT10:00:00Z"},`+
+			`"permissions":["read","write"],"quota":{"used":%d,"limit":10000}},"links":{"self":"/v1/accounts/%d"}}`,
+			rng.Uint32(), rng.Intn(1e5), rng.Intn(1e5), []string{"free", "pro", "enterprise"}[rng.Intn(3)],
+			1+rng.Intn(12), 1+rng.Intn(28), rng.Intn(10000), rng.Intn(1e5))))
+	}
+	return out
+}
+
+func TestBuild(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	train, test := payloads(rng, 500), payloads(rng, 100)
+
+	d, err := Build(train, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d) == 0 || len(d) > DefaultSize {
+		t.Fatalf("got a dictionary of %d bytes", len(d))
+	}
+	// The content shared by all samples goes at the end.
+	if tail := string(d[len(d)-200:]); !strings.Contains(tail, `"permissions":["read","write"]`) &&
+		!strings.Contains(tail, `"status":"ok","request_id":"`) {
+		t.Errorf("common content not at the end of the dictionary: %q", tail)
+	}
+
+	r, err := Evaluate(d, test, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Samples) != len(test) {
+		t.Fatalf("got %d results, want %d", len(r.Samples), len(test))
+	}
+	for i, res := range r.Samples {
+		if res.Size != len(test[i]) || res.WithDict >= res.Plain {
+			t.Errorf("sample %d: got %+v, want a smaller size with the dictionary", i, res)
+		}
+	}
+	if g := r.Total.Gain(); g < 0.3 {
+		t.Errorf("got a gain of %.2f, want at least 0.3: %v", g, r)
+	}
+
+	// The dictionary works for zlib, and round trips.
+	for _, s := range test[:10] {
+		var buf bytes.Buffer
+		w, err := zlib.NewWriterLevelDict(&buf, zlib.BestCompression, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(s)
+		w.Close()
+		zr, err := zlib.NewReaderDict(&buf, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		if err != nil || !bytes.Equal(got, s) {
+			t.Fatalf("zlib roundtrip failed: %v", err)
+		}
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	train := payloads(rng, 200)
+	for _, o := range []*Options{{Size: 1000}, {Size: 100, SegmentLen: 4}, {Size: 5000, SegmentLen: 200}} {
+		d, err := Build(train, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(d) == 0 || len(d) > o.Size {
+			t.Errorf("%+v: got a dictionary of %d bytes", o, len(d))
+		}
+	}
+
+	// Small corpora end up in the dictionary, without duplicates.
+	d, err := Build([][]byte{[]byte("hello, world"), []byte("hello, world")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(d) != "hello, world" {
+		t.Errorf("got %q, want %q", d, "hello, world")
+	}
+
+	if _, err := Build([][]byte{[]byte("short")}, nil); err != errNoSamples {
+		t.Errorf("got %v, want %v", err, errNoSamples)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dict
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// Result is the compressed size of a sample with and without a dictionary.
+type Result struct {
+	Size     int // uncompressed size
+	Plain    int // compressed size without the dictionary
+	WithDict int // compressed size with the dictionary
+}
+
+// Gain returns the fraction of the compressed size the dictionary saves.
+// It is negative if the dictionary makes the sample larger.
+func (r Result) Gain() float64 {
+	if r.Plain == 0 {
+		return 0
+	}
+	return 1 - float64(r.WithDict)/float64(r.Plain)
+}
+
+// Report holds the results of Evaluate.
+type Report struct {
+	Samples []Result // one per sample, in order
+	Total   Result   // sum of Samples
+}
+
+// String returns a summary of the report.
+func (r *Report) String() string {
+	t := r.Total
+	ratio := func(n int) float64 {
+		if n == 0 {
+			return 0
+		}
+		return float64(t.Size) / float64(n)
+	}
+	return fmt.Sprintf("%d samples, %d bytes: %d bytes compressed (ratio %.2f), %d with dictionary (ratio %.2f), %.1f%% smaller",
+		len(r.Samples), t.Size, t.Plain, ratio(t.Plain), t.WithDict, ratio(t.WithDict), 100*t.Gain())
+}
+
+// Evaluate compresses each sample with flate at level, with and without
+// dict, and reports the sizes. The samples should not be the ones dict was
+// built from, as the dictionary is bound to do well on those.
+//
+// zlib output is 4 bytes longer with a dictionary, for its identifier, and
+// otherwise the same size.
+func Evaluate(dict []byte, samples [][]byte, level int) (*Report, error) {
+	plain, err := flate.NewWriter(ioutil.Discard, level)
+	if err != nil {
+		return nil, err
+	}
+	withDict, err := flate.NewWriterDict(ioutil.Discard, level, dict)
+	if err != nil {
+		return nil, err
+	}
+	var cw countWriter
+	compressed := func(w *flate.Writer, s []byte) (int, error) {
+		cw = 0
+		w.Reset(&cw)
+		if _, err := w.Write(s); err != nil {
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		return int(cw), nil
+	}
+
+	r := &Report{Samples: make([]Result, 0, len(samples))}
+	for _, s := range samples {
+		res := Result{Size: len(s)}
+		if res.Plain, err = compressed(plain, s); err != nil {
+			return nil, err
+		}
+		if res.WithDict, err = compressed(withDict, s); err != nil {
+			return nil, err
+		}
+		r.Samples = append(r.Samples, res)
+		r.Total.Size += res.Size
+		r.Total.Plain += res.Plain
+		r.Total.WithDict += res.WithDict
+	}
+	return r, nil
+}
+
+type countWriter int
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	*c += countWriter(len(p))
+	return len(p), nil
+}
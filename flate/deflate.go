@@ -115,6 +115,7 @@ type compressor struct {
 	maxInsertIndex int
 	err            error
 	ii             uint16 // position of last match, intended to overflow to reset.
+	maxDist        int    // largest match offset; 0 means windowSize.
 
 	snap      snappyEnc
 	hashMatch [maxMatchLength + minMatchLength]uint32
@@ -246,6 +247,14 @@ func (d *compressor) fillWindow(b []byte) {
 	d.index = n
 }
 
+// maxOffset returns the largest offset matches may refer back.
+func (d *compressor) maxOffset() int {
+	if d.maxDist > 0 {
+		return d.maxDist
+	}
+	return windowSize
+}
+
 // Try to find a match starting at index whose length is greater than prevSize.
 // We only look at chainCount possibilities before giving up.
 // pos = d.index, prevHead = d.chainHead-d.hashOffset, prevLength=minMatchLength-1, lookahead
@@ -272,7 +281,7 @@ func (d *compressor) findMatch(pos int, prevHead int, prevLength int, lookahead
 
 	wEnd := win[pos+length]
 	wPos := win[pos:]
-	minIndex := pos - windowSize
+	minIndex := pos - d.maxOffset()
 
 	for i := prevHead; tries > 0; tries-- {
 		if wEnd == win[i+length] {
@@ -327,7 +336,7 @@ func (d *compressor) findMatchSSE(pos int, prevHead int, prevLength int, lookahe
 
 	wEnd := win[pos+length]
 	wPos := win[pos:]
-	minIndex := pos - windowSize
+	minIndex := pos - d.maxOffset()
 
 	for i := prevHead; tries > 0; tries-- {
 		if wEnd == win[i+length] {
@@ -402,8 +411,17 @@ func matchLen(a, b []byte, max int) int {
 	return max
 }
 
+// initWindow makes the window n bytes long, reusing its buffer if possible.
+func (d *compressor) initWindow(n int) {
+	if cap(d.window) >= n {
+		d.window = d.window[:n]
+		return
+	}
+	d.window = make([]byte, n)
+}
+
 func (d *compressor) initDeflate() {
-	d.window = make([]byte, 2*windowSize)
+	d.initWindow(2 * windowSize)
 	d.hashOffset = 1
 	d.length = minMatchLength - 1
 	d.offset = 0
@@ -467,7 +485,7 @@ func (d *compressor) deflate() {
 		}
 		d.length = minMatchLength - 1
 		d.offset = 0
-		minIndex := d.index - windowSize
+		minIndex := d.index - d.maxOffset()
 		if minIndex < 0 {
 			minIndex = 0
 		}
@@ -614,7 +632,7 @@ func (d *compressor) deflateLazy() {
 		prevOffset := d.offset
 		d.length = minMatchLength - 1
 		d.offset = 0
-		minIndex := d.index - windowSize
+		minIndex := d.index - d.maxOffset()
 		if minIndex < 0 {
 			minIndex = 0
 		}
@@ -782,7 +800,7 @@ func (d *compressor) deflateSSE() {
 		}
 		d.length = minMatchLength - 1
 		d.offset = 0
-		minIndex := d.index - windowSize
+		minIndex := d.index - d.maxOffset()
 		if minIndex < 0 {
 			minIndex = 0
 		}
@@ -930,7 +948,7 @@ func (d *compressor) deflateLazySSE() {
 		prevOffset := d.offset
 		d.length = minMatchLength - 1
 		d.offset = 0
-		minIndex := d.index - windowSize
+		minIndex := d.index - d.maxOffset()
 		if minIndex < 0 {
 			minIndex = 0
 		}
@@ -1105,6 +1123,9 @@ func (d *compressor) storeSnappy() {
 	}
 
 	d.snap.Encode(&d.tokens, d.window[:d.windowEnd])
+	if d.maxDist > 0 && d.maxDist < maxMatchOffset {
+		d.tokens.limitOffsets(d.window[:d.windowEnd], d.maxDist)
+	}
 	// If we made zero matches, store the block as is.
 	if int(d.tokens.n) == d.windowEnd {
 		d.err = d.writeStoredBlock(d.window[:d.windowEnd])
@@ -1152,21 +1173,27 @@ func (d *compressor) syncFlush() error {
 	return d.err
 }
 
+// init sets up the compressor for level. The bit writer and the window
+// of a compressor used before are reused.
 func (d *compressor) init(w io.Writer, level int) (err error) {
-	d.w = newHuffmanBitWriter(w)
+	if d.w == nil {
+		d.w = newHuffmanBitWriter(w)
+	} else {
+		d.w.reset(w)
+	}
 
 	switch {
 	case level == NoCompression:
-		d.window = make([]byte, maxStoreBlockSize)
+		d.initWindow(maxStoreBlockSize)
 		d.fill = (*compressor).fillBlock
 		d.step = (*compressor).store
 	case level == ConstantCompression:
-		d.window = make([]byte, maxStoreBlockSize)
+		d.initWindow(maxStoreBlockSize)
 		d.fill = (*compressor).fillBlock
 		d.step = (*compressor).storeHuff
 	case level >= 1 && level <= 4:
 		d.snap = newSnappy(level)
-		d.window = make([]byte, maxStoreBlockSize)
+		d.initWindow(maxStoreBlockSize)
 		d.fill = (*compressor).fillBlock
 		d.step = (*compressor).storeSnappy
 	case level == DefaultCompression:
@@ -1265,6 +1292,7 @@ func NewWriter(w io.Writer, level int) (*Writer, error) {
 	if err := dw.d.init(w, level); err != nil {
 		return nil, err
 	}
+	dw.level = level
 	return &dw, nil
 }
 
@@ -1296,8 +1324,9 @@ func (w *dictWriter) Write(b []byte) (n int, err error) {
 // A Writer takes data written to it and writes the compressed
 // form of that data to an underlying writer (see NewWriter).
 type Writer struct {
-	d    compressor
-	dict []byte
+	d     compressor
+	dict  []byte
+	level int
 }
 
 // Write writes data to w, which will eventually write the
@@ -1349,3 +1378,37 @@ func (w *Writer) ResetDict(dst io.Writer, dict []byte) {
 	w.d.reset(dst)
 	w.d.fillWindow(w.dict)
 }
+
+// ResetLevelDict discards the writer's state and makes it equivalent to
+// the result of NewWriterDict called with dst, level and dict, which may
+// be nil. The window and the other buffers are reused. The error returned
+// will be nil if the level is valid, and the Writer is left unchanged
+// otherwise.
+func (w *Writer) ResetLevelDict(dst io.Writer, level int, dict []byte) error {
+	if level < HuffmanOnly || level > BestCompression {
+		return fmt.Errorf("flate: invalid compression level %d: want value in range [-2, 9]", level)
+	}
+	if level != w.level {
+		w.d.snap = nil
+		w.d.compressionLevel = compressionLevel{}
+		if err := w.d.init(dst, level); err != nil {
+			return err
+		}
+		w.level = level
+	}
+	w.ResetDict(dst, dict)
+	return nil
+}
+
+// SetWindowSize limits how far back matches refer to size bytes, so the
+// output can be decompressed with a window of that size, like the one a
+// zlib header advertises. Smaller windows find fewer matches. The size
+// must be between 1 and 32768, the default. It applies to the data
+// written after the call, and is kept by the Reset methods.
+func (w *Writer) SetWindowSize(size int) error {
+	if size < minOffsetSize || size > windowSize {
+		return fmt.Errorf("flate: invalid window size %d: want value in range [1, %d]", size, windowSize)
+	}
+	w.d.maxDist = size
+	return nil
+}
@@ -73,6 +73,47 @@ type Resetter interface {
 	Reset(r io.Reader, dict []byte) error
 }
 
+// A Checkpoint is a position at the start of a block in a DEFLATE stream,
+// from which decoding can be resumed using NewReaderCheckpoint.
+type Checkpoint struct {
+	In   int64  // Offset of the block in the compressed stream, in bits
+	Out  int64  // Offset of the block in the uncompressed stream, in bytes
+	Hist []byte // Up to 32KB of uncompressed data preceding Out
+}
+
+// Checkpointer is implemented by the ReadCloser returned by NewReader,
+// NewReaderDict and NewReaderCheckpoint, to record positions that allow
+// random access to the uncompressed data.
+type Checkpointer interface {
+	// SetCheckpoints makes the reader call fn with a Checkpoint at the
+	// start of every block that begins at least interval bytes after
+	// the previous Checkpoint, or after the point decoding started.
+	// Checkpoints are reported in stream order, before the block is
+	// read. A nil fn disables checkpoints. Reset also disables them.
+	SetCheckpoints(interval int64, fn func(Checkpoint))
+}
+
+// A Block describes a block of a DEFLATE stream, as reported by a
+// BlockReporter.
+type Block struct {
+	Start int64 // Offset of the block in the compressed stream, in bits
+	End   int64 // Offset of the end of the block in the compressed stream, in bits
+	Out   int64 // Offset of the end of the block in the uncompressed stream, in bytes
+	Final bool  // Whether the block is the last of the stream
+}
+
+// BlockReporter is implemented by the ReadCloser returned by NewReader,
+// NewReaderDict and NewReaderCheckpoint, to locate the blocks of a
+// stream, for example to join or split streams without recompressing
+// them.
+type BlockReporter interface {
+	// ReportBlocks makes the reader call fn with every block once it
+	// has been decoded, which may be before its data has been read.
+	// Blocks are reported in stream order. A nil fn disables reporting.
+	// Reset also disables it.
+	ReportBlocks(fn func(Block))
+}
+
 // The data structure for decoding Huffman tables is based on that of
 // zlib. There is a lookup table of a fixed bit width (huffmanChunkBits),
 // For codes smaller than the table width, there are multiple entries
@@ -295,9 +336,49 @@ type decompressor struct {
 	hl, hd    *huffmanDecoder
 	copyLen   int
 	copyDist  int
+
+	// Checkpoint reporting, see SetCheckpoints.
+	cpInterval int64
+	cpFunc     func(Checkpoint)
+	cpLast     int64
+
+	// Block reporting, see ReportBlocks.
+	blockFunc  func(Block)
+	blockStart int64
+}
+
+func (f *decompressor) SetCheckpoints(interval int64, fn func(Checkpoint)) {
+	f.cpInterval = interval
+	f.cpFunc = fn
+	f.cpLast = f.dict.flushed + int64(f.dict.availRead())
+}
+
+// checkpoint reports the current position if it is due.
+// It must only be called at the start of a block.
+func (f *decompressor) checkpoint() {
+	out := f.dict.flushed + int64(f.dict.availRead())
+	if out-f.cpLast < f.cpInterval {
+		return
+	}
+	f.cpLast = out
+	f.cpFunc(Checkpoint{
+		In:   f.roffset*8 - int64(f.nb),
+		Out:  out,
+		Hist: f.dict.appendHist(nil),
+	})
+}
+
+func (f *decompressor) ReportBlocks(fn func(Block)) {
+	f.blockFunc = fn
 }
 
 func (f *decompressor) nextBlock() {
+	if f.cpFunc != nil {
+		f.checkpoint()
+	}
+	if f.blockFunc != nil {
+		f.blockStart = f.roffset*8 - int64(f.nb)
+	}
 	for f.nb < 1+2 {
 		if f.err = f.moreBits(); f.err != nil {
 			return
@@ -713,6 +794,14 @@ func (f *decompressor) copyData() {
 }
 
 func (f *decompressor) finishBlock() {
+	if f.blockFunc != nil {
+		f.blockFunc(Block{
+			Start: f.blockStart,
+			End:   f.roffset*8 - int64(f.nb),
+			Out:   f.dict.flushed + int64(f.dict.availRead()),
+			Final: f.final,
+		})
+	}
 	if f.final {
 		if f.dict.availRead() > 0 {
 			f.toRead = f.dict.readFlush()
@@ -844,3 +933,35 @@ func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
 	f.dict.init(maxMatchOffset, dict)
 	return &f
 }
+
+// NewReaderCheckpoint returns a ReadCloser that resumes decoding a DEFLATE
+// stream at a Checkpoint recorded by a Checkpointer.
+// The reader r must be positioned at byte cp.In/8 of the compressed stream.
+// Checkpoints recorded by the returned reader use the same offsets as cp.
+//
+// The ReadCloser returned by NewReaderCheckpoint also implements Resetter.
+func NewReaderCheckpoint(r io.Reader, cp Checkpoint) io.ReadCloser {
+	fixedHuffmanDecoderInit()
+
+	var f decompressor
+	f.r = makeReader(r)
+	f.roffset = cp.In / 8
+	f.bits = new([maxNumLit + maxNumDist]int)
+	f.codebits = new([numCodes]int)
+	f.step = (*decompressor).nextBlock
+	if skip := uint(cp.In % 8); skip > 0 {
+		// The block starts inside a byte. Skip the bits
+		// belonging to the previous block before decoding.
+		f.step = func(f *decompressor) {
+			if f.err = f.moreBits(); f.err != nil {
+				return
+			}
+			f.b >>= skip
+			f.nb -= skip
+			f.nextBlock()
+		}
+	}
+	f.dict.init(maxMatchOffset, cp.Hist)
+	f.dict.flushed = cp.Out
+	return &f
+}
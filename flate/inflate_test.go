@@ -280,3 +280,105 @@ func TestWriteTo(t *testing.T) {
 		t.Fatal("output did not match input")
 	}
 }
+
+func TestReaderCheckpoint(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []int{0, 1, 2, 5, 9, -2} {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, level)
+		w.Write(data)
+		w.Close()
+		compressed := buf.Bytes()
+
+		var cps []Checkpoint
+		f := NewReader(bytes.NewReader(compressed))
+		f.(Checkpointer).SetCheckpoints(32<<10, func(cp Checkpoint) {
+			cps = append(cps, cp)
+		})
+		got, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("level %d: output mismatch", level)
+		}
+		if len(cps) == 0 {
+			t.Fatalf("level %d: no checkpoints", level)
+		}
+		for i, cp := range cps {
+			if i > 0 && cp.Out-cps[i-1].Out < 32<<10 {
+				t.Errorf("level %d: checkpoint %d at %d, previous at %d", level, i, cp.Out, cps[i-1].Out)
+			}
+			r := NewReaderCheckpoint(bytes.NewReader(compressed[cp.In/8:]), cp)
+			var resumed []Checkpoint
+			r.(Checkpointer).SetCheckpoints(32<<10, func(cp Checkpoint) {
+				resumed = append(resumed, cp)
+			})
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("level %d: checkpoint %d: %v", level, i, err)
+			}
+			if !bytes.Equal(got, data[cp.Out:]) {
+				t.Fatalf("level %d: checkpoint %d: output mismatch", level, i)
+			}
+			if len(resumed) > 0 && resumed[0].In != cps[i+1].In {
+				t.Errorf("level %d: resumed checkpoint at bit %d, want %d", level, resumed[0].In, cps[i+1].In)
+			}
+		}
+	}
+}
+
+func TestReportBlocks(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []int{0, 1, 5, 9, -2} {
+		var buf bytes.Buffer
+		w, _ := NewWriter(&buf, level)
+		w.Write(data[:len(data)/2])
+		w.Flush()
+		w.Write(data[len(data)/2:])
+		w.Close()
+		compressed := buf.Bytes()
+
+		var blocks []Block
+		f := NewReader(bytes.NewReader(compressed))
+		f.(BlockReporter).ReportBlocks(func(b Block) {
+			blocks = append(blocks, b)
+		})
+		got, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("level %d: output mismatch", level)
+		}
+		if len(blocks) < 2 {
+			t.Fatalf("level %d: got %d blocks", level, len(blocks))
+		}
+		flushed := false
+		for i, b := range blocks {
+			if i > 0 && b.Start != blocks[i-1].End || b.End <= b.Start {
+				t.Errorf("level %d: block %d spans bits %d to %d, previous ends at %d", level, i, b.Start, b.End, blocks[i-1].End)
+			}
+			if b.Final != (i == len(blocks)-1) {
+				t.Errorf("level %d: block %d: got Final %t", level, i, b.Final)
+			}
+			// The empty stored block written by Flush ends byte aligned.
+			if b.Out == int64(len(data)/2) && b.End%8 == 0 && string(compressed[b.End/8-4:b.End/8]) == "\x00\x00\xff\xff" {
+				flushed = true
+			}
+		}
+		last := blocks[len(blocks)-1]
+		if last.Out != int64(len(data)) || (last.End+7)/8 != int64(len(compressed)) {
+			t.Errorf("level %d: last block ends at bit %d, output %d; want %d bytes, output %d", level, last.End, last.Out, len(compressed), len(data))
+		}
+		if !flushed {
+			t.Errorf("level %d: flush point not reported", level)
+		}
+	}
+}
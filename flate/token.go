@@ -74,6 +74,43 @@ type tokens struct {
 	n      uint16 // Must be able to contain maxStoreBlockSize
 }
 
+// limitOffsets replaces the matches in t that refer back more than max
+// bytes with literals, given the data src encoded by t.
+func (t *tokens) limitOffsets(src []byte, max int) {
+	n := int(t.n)
+	for _, tok := range t.tokens[:t.n] {
+		if tok.typ() == matchType && int(tok.offset())+minOffsetSize > max {
+			n += int(tok.length()) + baseMatchLength - 1
+		}
+	}
+	if n == int(t.n) {
+		return
+	}
+	// The tokens only grow, so they can be rewritten in place from the end.
+	pos, w := len(src), n
+	for r := int(t.n) - 1; r >= 0; r-- {
+		tok := t.tokens[r]
+		if tok.typ() != matchType {
+			pos--
+			w--
+			t.tokens[w] = tok
+			continue
+		}
+		l := int(tok.length()) + baseMatchLength
+		pos -= l
+		if int(tok.offset())+minOffsetSize <= max {
+			w--
+			t.tokens[w] = tok
+			continue
+		}
+		for i := l - 1; i >= 0; i-- {
+			w--
+			t.tokens[w] = literalToken(uint32(src[pos+i]))
+		}
+	}
+	t.n = uint16(n)
+}
+
 // Convert a literal into a literal token.
 func literalToken(literal uint32) token { return token(literalType + literal) }
 
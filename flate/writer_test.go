@@ -256,3 +256,73 @@ func copyBuffer(dst io.Writer, src io.Reader, buf []byte) (written int64, err er
 	}
 	return written, err
 }
+
+func TestWriterWindowSize(t *testing.T) {
+	// Random data repeating every 2048 bytes only compresses with back
+	// references beyond a window of 1024 bytes.
+	rnd := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(rnd)
+	periodic := bytes.Repeat(rnd, 64)
+	text, err := ioutil.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for level := BestSpeed; level <= BestCompression; level++ {
+		for _, window := range []int{256, 1024, 3000, windowSize} {
+			for i, in := range [][]byte{periodic, text} {
+				var buf bytes.Buffer
+				w, _ := NewWriter(&buf, level)
+				if err := w.SetWindowSize(window); err != nil {
+					t.Fatal(err)
+				}
+				w.Write(in)
+				w.Close()
+				if i == 0 && window <= 1024 && buf.Len() < len(in)*9/10 {
+					t.Errorf("level %d, window %d: compressed to %d bytes, want no matches", level, window, buf.Len())
+				}
+				got, err := ioutil.ReadAll(NewReader(&buf))
+				if err != nil || !bytes.Equal(got, in) {
+					t.Errorf("level %d, window %d: roundtrip failed: %v", level, window, err)
+				}
+			}
+		}
+	}
+
+	w, _ := NewWriter(ioutil.Discard, DefaultCompression)
+	for _, size := range []int{0, windowSize + 1} {
+		if err := w.SetWindowSize(size); err == nil {
+			t.Errorf("window size %d: got nil error", size)
+		}
+	}
+}
+
+func TestWriterResetLevelDict(t *testing.T) {
+	in, err := ioutil.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dict := in[:1000]
+	in = in[1000:]
+	w, _ := NewWriter(ioutil.Discard, BestSpeed)
+	w.Write(in)
+	w.Close()
+	for _, level := range []int{BestCompression, 3, BestCompression, NoCompression, HuffmanOnly, DefaultCompression, BestSpeed} {
+		for _, dict := range [][]byte{nil, dict} {
+			var got, want bytes.Buffer
+			if err := w.ResetLevelDict(&got, level, dict); err != nil {
+				t.Fatal(err)
+			}
+			w.Write(in)
+			w.Close()
+			w2, _ := NewWriterDict(&want, level, dict)
+			w2.Write(in)
+			w2.Close()
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Errorf("level %d, dict %t: output differs from a new Writer", level, dict != nil)
+			}
+		}
+	}
+	if err := w.ResetLevelDict(ioutil.Discard, 10, nil); err == nil {
+		t.Error("level 10: got nil error")
+	}
+}
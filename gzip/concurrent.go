@@ -0,0 +1,443 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/crc32"
+)
+
+const (
+	defaultBlockSize = 1 << 20
+
+	// bgzfMaxSize is the largest BGZF block, and the largest block
+	// header that needs to be inspected.
+	bgzfMaxSize = 1 << 16
+
+	// bgzfHeaderLen is the size of a BGZF header up to the extra
+	// subfields.
+	bgzfHeaderLen = 12
+)
+
+var errClosed = errors.New("gzip: reader is closed")
+
+// A ConcurrentReader is an io.Reader that decompresses gzip data ahead
+// of the reads on separate goroutines, like Reader.
+//
+// Data is inflated into a ring of buffers on one goroutine, while the
+// CRC-32 is computed on another. Members that record their compressed
+// size in a BGZF "BC" extra subfield, as used by bgzip and many
+// bioinformatics formats, are inflated in parallel on all cores.
+// Other members must be inflated in order, since their end is only
+// found by decompressing them.
+//
+// Like Reader, a ConcurrentReader reads all members of a multistream
+// gzip file, and only records the first header.
+type ConcurrentReader struct {
+	Header // valid after NewConcurrentReader
+
+	br        *bufio.Reader
+	blockSize int
+	items     chan *block // blocks in stream order, possibly still being filled
+	out       chan *block // verified blocks, ready to be read
+	free      chan []byte // buffers available for new blocks
+	done      chan struct{}
+	stopOnce  sync.Once
+
+	cur  *block
+	data []byte // unread part of cur
+	err  error
+}
+
+// block is a piece of the uncompressed output.
+type block struct {
+	buf  []byte // buffer from the free list, if any
+	data []byte
+	err  error
+
+	// ready is closed when a worker has filled in data and err.
+	// It is nil for blocks filled in when they are queued.
+	ready chan struct{}
+
+	crc          bool   // data is not verified yet and goes into the checksum
+	end          bool   // end of a member; digest and size are from its trailer
+	digest, size uint32 // trailer values
+}
+
+// bgzfJob is a BGZF member to be inflated by a worker.
+type bgzfJob struct {
+	raw []byte
+	b   *block
+}
+
+// NewConcurrentReader creates a new ConcurrentReader reading the given
+// reader. Up to blocks buffers of blockSize bytes are used for the
+// decompressed data. If blockSize <= 0, 1MB is used, and if blocks <= 0,
+// twice the number of CPUs, but at least 4.
+//
+// The header of the first member is read before NewConcurrentReader
+// returns. It is the caller's responsibility to call Close on the
+// ConcurrentReader when done, to stop the goroutines.
+func NewConcurrentReader(r io.Reader, blockSize, blocks int) (*ConcurrentReader, error) {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	if blocks <= 0 {
+		blocks = 2 * runtime.GOMAXPROCS(0)
+		if blocks < 4 {
+			blocks = 4
+		}
+	}
+	z := &ConcurrentReader{
+		br:        bufio.NewReaderSize(r, bgzfHeaderLen+bgzfMaxSize),
+		blockSize: blockSize,
+		items:     make(chan *block, blocks),
+		out:       make(chan *block, blocks),
+		free:      make(chan []byte, blocks),
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < blocks; i++ {
+		z.free <- nil // allocated on first use
+	}
+
+	// Read the first header, to report it and any error right away.
+	zr := &Reader{r: z.br}
+	if _, ok := z.bgzfSize(); ok {
+		hdr, err := readHeaderOnly(z.br)
+		if err != nil {
+			return nil, err
+		}
+		z.Header = hdr
+		go z.produce(zr, false)
+	} else {
+		hdr, err := zr.readHeader()
+		if err != nil {
+			return nil, err
+		}
+		z.Header = hdr
+		go z.produce(zr, true)
+	}
+	go z.sequence()
+	return z, nil
+}
+
+// readHeaderOnly parses the header at the start of br without
+// consuming it.
+func readHeaderOnly(br *bufio.Reader) (Header, error) {
+	b, _ := br.Peek(br.Buffered())
+	zr := &Reader{r: bytes.NewReader(b)}
+	return zr.readHeader()
+}
+
+// bgzfSize returns the total size of the member at the start of z.br,
+// if it is a BGZF block that fits in a buffer.
+func (z *ConcurrentReader) bgzfSize() (int, bool) {
+	hdr, err := z.br.Peek(bgzfHeaderLen)
+	if err != nil || hdr[0] != gzipID1 || hdr[1] != gzipID2 || hdr[2] != gzipDeflate || hdr[3]&flagExtra == 0 {
+		return 0, false
+	}
+	hdr, err = z.br.Peek(bgzfHeaderLen + int(le.Uint16(hdr[10:12])))
+	if err != nil {
+		return 0, false
+	}
+	bsize, ok := extraSubfield(hdr[bgzfHeaderLen:], 'B', 'C')
+	if !ok || len(bsize) != 2 {
+		return 0, false
+	}
+	size := int(le.Uint16(bsize)) + 1
+	if size < len(hdr)+8 {
+		return 0, false
+	}
+	// The trailer tells the uncompressed size, which must fit.
+	trailer, err := z.br.Peek(size)
+	if err != nil || int64(le.Uint32(trailer[size-4:])) > int64(z.blockSize) {
+		return 0, false
+	}
+	return size, true
+}
+
+// extraSubfield returns the data of the first subfield of extra
+// identified by si1 and si2, and whether it was found.
+func extraSubfield(extra []byte, si1, si2 byte) ([]byte, bool) {
+	for len(extra) >= 4 {
+		n := int(le.Uint16(extra[2:4]))
+		if 4+n > len(extra) {
+			break
+		}
+		if extra[0] == si1 && extra[1] == si2 {
+			return extra[4 : 4+n : 4+n], true
+		}
+		extra = extra[4+n:]
+	}
+	return nil, false
+}
+
+// getBuf returns a buffer from the free list, or nil if the reader
+// is being closed.
+func (z *ConcurrentReader) getBuf() []byte {
+	select {
+	case buf := <-z.free:
+		if buf == nil {
+			buf = make([]byte, z.blockSize)
+		}
+		return buf
+	case <-z.done:
+		return nil
+	}
+}
+
+// push queues b for the sequencer. It returns false if the reader
+// is being closed.
+func (z *ConcurrentReader) push(b *block) bool {
+	select {
+	case z.items <- b:
+		return true
+	case <-z.done:
+		return false
+	}
+}
+
+func (z *ConcurrentReader) stop() {
+	z.stopOnce.Do(func() { close(z.done) })
+}
+
+// produce splits the input into blocks. If inMember is set, the header
+// of the first member has already been read by zr.
+func (z *ConcurrentReader) produce(zr *Reader, inMember bool) {
+	defer close(z.items)
+	var jobs chan bgzfJob
+	defer func() {
+		if jobs != nil {
+			close(jobs)
+		}
+	}()
+	for {
+		if !inMember {
+			if size, ok := z.bgzfSize(); ok {
+				if jobs == nil {
+					jobs = make(chan bgzfJob, cap(z.items))
+					for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+						go inflateBGZF(jobs)
+					}
+				}
+				buf := z.getBuf()
+				if buf == nil {
+					return
+				}
+				raw := make([]byte, size)
+				io.ReadFull(z.br, raw) // already buffered by bgzfSize
+				b := &block{buf: buf, ready: make(chan struct{})}
+				jobs <- bgzfJob{raw: raw, b: b}
+				if !z.push(b) {
+					return
+				}
+				continue
+			}
+			if _, err := zr.readHeader(); err != nil {
+				if err != io.EOF {
+					z.push(&block{err: err})
+				}
+				return
+			}
+		}
+		inMember = false
+		if !z.inflateMember(zr) {
+			return
+		}
+	}
+}
+
+// inflateMember inflates the current member of zr into blocks,
+// leaving the checksum to the sequencer. It returns false if
+// inflating should stop.
+func (z *ConcurrentReader) inflateMember(zr *Reader) bool {
+	for {
+		buf := z.getBuf()
+		if buf == nil {
+			return false
+		}
+		var n int
+		var err error
+		for n < len(buf) && err == nil {
+			var nn int
+			nn, err = zr.decompressor.Read(buf[n:])
+			n += nn
+		}
+		b := &block{buf: buf, data: buf[:n], crc: true}
+		if err != nil && err != io.EOF {
+			b.err = err
+			z.push(b)
+			return false
+		}
+		if !z.push(b) {
+			return false
+		}
+		if err == io.EOF {
+			var trailer [8]byte
+			if _, err := io.ReadFull(z.br, trailer[:]); err != nil {
+				z.push(&block{err: noEOF(err)})
+				return false
+			}
+			return z.push(&block{
+				end:    true,
+				digest: le.Uint32(trailer[:4]),
+				size:   le.Uint32(trailer[4:]),
+			})
+		}
+	}
+}
+
+// inflateBGZF inflates and verifies BGZF members from jobs.
+func inflateBGZF(jobs <-chan bgzfJob) {
+	var zr Reader
+	for j := range jobs {
+		j.b.data, j.b.err = inflateRaw(&zr, j.raw, j.b.buf)
+		close(j.b.ready)
+	}
+}
+
+// inflateRaw inflates the complete gzip member raw into buf,
+// which must hold the size given in its trailer.
+func inflateRaw(zr *Reader, raw, buf []byte) ([]byte, error) {
+	if err := zr.Reset(bytes.NewReader(raw)); err != nil {
+		return nil, noEOF(err)
+	}
+	zr.Multistream(false)
+	data := buf[:le.Uint32(raw[len(raw)-4:])]
+	var n int
+	var err error
+	for n < len(data) && err == nil {
+		var nn int
+		nn, err = zr.Read(data[n:])
+		n += nn
+	}
+	if err == nil {
+		// All data is read, but the trailer is not verified yet.
+		var extra [1]byte
+		if nn, _ := zr.Read(extra[:]); nn > 0 {
+			err = ErrChecksum
+		} else {
+			err = zr.err
+		}
+	}
+	if err != io.EOF {
+		return data[:n], err
+	}
+	if n != len(data) {
+		// The member ended before the size read from the end of raw,
+		// so raw holds more than the member.
+		return data[:n], io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+// sequence waits for the blocks in stream order, verifies the
+// checksums of members inflated by produce, and passes them on.
+func (z *ConcurrentReader) sequence() {
+	defer close(z.out)
+	var digest, size uint32
+	for b := range z.items {
+		if b.ready != nil {
+			select {
+			case <-b.ready:
+			case <-z.done:
+				return
+			}
+		}
+		if b.crc {
+			digest = crc32.Update(digest, crc32.IEEETable, b.data)
+			size += uint32(len(b.data))
+		}
+		if b.end {
+			if b.digest != digest || b.size != size {
+				b.err = ErrChecksum
+			}
+			digest, size = 0, 0
+		}
+		select {
+		case z.out <- b:
+		case <-z.done:
+			return
+		}
+		if b.err != nil {
+			z.stop()
+			return
+		}
+	}
+}
+
+// next makes the next block current, returning the previous buffer to
+// the free list.
+func (z *ConcurrentReader) next() {
+	if z.cur != nil && z.cur.buf != nil {
+		z.free <- z.cur.buf // never blocks, the list has room for all buffers
+	}
+	z.cur = nil
+	b, ok := <-z.out
+	if !ok {
+		z.err = io.EOF
+		return
+	}
+	z.cur, z.data, z.err = b, b.data, b.err
+}
+
+// Read implements io.Reader, reading uncompressed bytes from its underlying Reader.
+func (z *ConcurrentReader) Read(p []byte) (int, error) {
+	for len(z.data) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.next()
+	}
+	n := copy(p, z.data)
+	z.data = z.data[n:]
+	return n, nil
+}
+
+// WriteTo implements io.WriterTo, writing the decompressed blocks to w
+// without copying them.
+func (z *ConcurrentReader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for {
+		if len(z.data) > 0 {
+			n, err := w.Write(z.data)
+			total += int64(n)
+			z.data = z.data[n:]
+			if err == nil && len(z.data) > 0 {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+		if z.err != nil {
+			if z.err == io.EOF {
+				return total, nil
+			}
+			return total, z.err
+		}
+		z.next()
+	}
+}
+
+// Close stops decompressing and releases the buffers. It does not close
+// the underlying io.Reader. A goroutine blocked reading from it exits once
+// that read returns.
+// In order for the GZIP checksum to be verified, the reader must be
+// fully consumed until the io.EOF.
+func (z *ConcurrentReader) Close() error {
+	z.stop()
+	if z.err == nil || z.err == io.EOF {
+		z.err = errClosed
+	}
+	z.cur, z.data = nil, nil
+	return nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import "errors"
+
+var errExtra = errors.New("gzip: malformed extra subfields")
+
+// An ExtraSubfield is a subfield of Header.Extra, as described in
+// RFC 1952, section 2.3.1.1. Extra data is usually made up of subfields,
+// each identified by two bytes, SI1 and SI2.
+type ExtraSubfield struct {
+	ID   [2]byte // SI1 and SI2
+	Data []byte
+}
+
+// ExtraSubfields returns the subfields of h.Extra in order. It returns
+// an error if h.Extra is not a sequence of subfields.
+func (h *Header) ExtraSubfields() ([]ExtraSubfield, error) {
+	var fields []ExtraSubfield
+	extra := h.Extra
+	for len(extra) > 0 {
+		if len(extra) < 4 {
+			return nil, errExtra
+		}
+		n := int(le.Uint16(extra[2:4]))
+		if 4+n > len(extra) {
+			return nil, errExtra
+		}
+		fields = append(fields, ExtraSubfield{
+			ID:   [2]byte{extra[0], extra[1]},
+			Data: extra[4 : 4+n : 4+n],
+		})
+		extra = extra[4+n:]
+	}
+	return fields, nil
+}
+
+// ExtraSubfield returns the data of the first subfield of h.Extra
+// identified by si1 and si2, and whether it was found.
+func (h *Header) ExtraSubfield(si1, si2 byte) ([]byte, bool) {
+	return extraSubfield(h.Extra, si1, si2)
+}
+
+// SetExtraSubfield sets the data of the subfield identified by si1 and si2
+// in h.Extra, replacing the first such subfield or adding a new one.
+// If data is nil, the subfields with that identifier are removed.
+// It returns an error if h.Extra is not a sequence of subfields,
+// or if it would be too large.
+func (h *Header) SetExtraSubfield(si1, si2 byte, data []byte) error {
+	fields, err := h.ExtraSubfields()
+	if err != nil {
+		return err
+	}
+	var extra []byte
+	found := false
+	for _, f := range fields {
+		if f.ID == [2]byte{si1, si2} {
+			if data == nil || found {
+				continue
+			}
+			f.Data = data
+			found = true
+		}
+		extra = appendSubfield(extra, f)
+	}
+	if !found && data != nil {
+		extra = appendSubfield(extra, ExtraSubfield{ID: [2]byte{si1, si2}, Data: data})
+	}
+	if len(extra) > 0xffff {
+		return errors.New("gzip: extra data is too large")
+	}
+	h.Extra = extra
+	return nil
+}
+
+func appendSubfield(b []byte, f ExtraSubfield) []byte {
+	b = append(b, f.ID[0], f.ID[1], byte(len(f.Data)), byte(len(f.Data)>>8))
+	return append(b, f.Data...)
+}
@@ -18,14 +18,15 @@ import (
 )
 
 const (
-	gzipID1     = 0x1f
-	gzipID2     = 0x8b
-	gzipDeflate = 8
-	flagText    = 1 << 0
-	flagHdrCrc  = 1 << 1
-	flagExtra   = 1 << 2
-	flagName    = 1 << 3
-	flagComment = 1 << 4
+	gzipID1      = 0x1f
+	gzipID2      = 0x8b
+	gzipDeflate  = 8
+	flagText     = 1 << 0
+	flagHdrCrc   = 1 << 1
+	flagExtra    = 1 << 2
+	flagName     = 1 << 3
+	flagComment  = 1 << 4
+	flagReserved = 0xe0
 )
 
 var (
@@ -52,10 +53,22 @@ func noEOF(err error) error {
 // U+0001 through U+00FF, due to limitations of the GZIP file format.
 type Header struct {
 	Comment string    // comment
-	Extra   []byte    // "extra data"
+	Extra   []byte    // "extra data", see ExtraSubfield
 	ModTime time.Time // modification time
 	Name    string    // file name
 	OS      byte      // operating system type
+
+	// Text is set if the data is probably ASCII text (FTEXT).
+	Text bool
+
+	// HeaderCRC is set if the header is protected by a CRC-16 (FHCRC).
+	// A Reader verifies it, and a Writer computes it.
+	HeaderCRC bool
+
+	// XFL holds the extra flags: 2 for maximum compression and 4 for
+	// the fastest algorithm. If zero, a Writer sets it from its
+	// compression level.
+	XFL byte
 }
 
 // A Reader is an io.Reader that can be read to retrieve
@@ -65,6 +78,7 @@ type Header struct {
 // each with its own header. Reads from the Reader
 // return the concatenation of the uncompressed data of each.
 // Only the first header is recorded in the Reader fields.
+// HandleMembers reports the header and trailer of every member.
 //
 // Gzip files store a length and checksum of the uncompressed data.
 // The Reader will return a ErrChecksum when Read
@@ -72,6 +86,10 @@ type Header struct {
 // have the expected length or checksum. Clients should treat data
 // returned by Read as tentative until they receive the io.EOF
 // marking the end of the data.
+//
+// Damaged input normally ends reading with an error. After a call to
+// Lenient, the Reader reports the offset of the damage, and can resume
+// reading at the next member.
 type Reader struct {
 	Header       // valid after NewReader or Reader.Reset
 	r            flate.Reader
@@ -81,6 +99,54 @@ type Reader struct {
 	buf          [512]byte
 	err          error
 	multistream  bool
+
+	// Member tracking, see HandleMembers.
+	member      Member
+	hdrLen      int64 // Size of the header of the current member
+	cr          *countReader
+	headerFunc  func(Member)
+	trailerFunc func(Member)
+
+	// Recovery from damaged input, see Lenient.
+	br       *bufio.Reader
+	lenient  bool
+	resync   bool
+	resuming bool // z.err is a *RecoveryError to resync after
+}
+
+// A Member describes one member of a gzip stream, as passed to the
+// functions set with Reader.HandleMembers.
+type Member struct {
+	Header
+
+	// Offset is the position of the member in the compressed input,
+	// counted from where the Reader started reading.
+	Offset int64
+
+	// The following fields are set once the trailer has been read.
+	Size             int64  // Compressed size, including header and trailer
+	UncompressedSize int64  // Size of the uncompressed data
+	CRC32            uint32 // CRC-32 of the uncompressed data
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	r flate.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
 }
 
 // NewReader creates a new Reader reading the given reader.
@@ -135,6 +201,53 @@ func (z *Reader) Multistream(ok bool) {
 	z.multistream = ok
 }
 
+// HandleMembers sets functions that are called for each member of a
+// multistream gzip file. header is called when the header of a member
+// has been read, and trailer when its trailer has been read and the
+// checksum and size verified. Either may be nil.
+//
+// The header of the first member is read by NewReader and Reset, so if
+// that succeeded, header is called for it before HandleMembers returns.
+//
+// HandleMembers must be called before the first Read or WriteTo, since
+// the compressed input is counted from there to find member offsets.
+// Reset removes the functions.
+func (z *Reader) HandleMembers(header, trailer func(Member)) {
+	z.countInput()
+	z.headerFunc, z.trailerFunc = header, trailer
+	if header != nil && z.err == nil {
+		header(z.member)
+	}
+}
+
+// countInput starts counting the compressed input read by z.
+func (z *Reader) countInput() {
+	if z.cr == nil && z.err == nil {
+		z.cr = &countReader{r: z.r, n: z.hdrLen}
+		z.r = z.cr
+		z.decompressor.(flate.Resetter).Reset(z.r, nil)
+	}
+}
+
+// offset returns the number of compressed bytes read so far,
+// if member tracking is enabled.
+func (z *Reader) offset() int64 {
+	if z.cr == nil {
+		return 0
+	}
+	return z.cr.n
+}
+
+// memberDone records the trailer of the current member and
+// reports the member to the trailer function, if set.
+func (z *Reader) memberDone() {
+	z.member.Size = z.offset() - z.member.Offset
+	z.member.CRC32 = z.digest
+	if z.trailerFunc != nil {
+		z.trailerFunc(z.member)
+	}
+}
+
 // readString reads a NUL-terminated string from z.r.
 // It treats the bytes read as being encoded as ISO 8859-1 (Latin-1) and
 // will output a string encoded using UTF-8.
@@ -154,6 +267,7 @@ func (z *Reader) readString() (string, error) {
 			needConv = true
 		}
 		if z.buf[i] == 0 {
+			z.hdrLen += int64(i + 1)
 			// Digest covers the NUL terminator.
 			z.digest = crc32.Update(z.digest, crc32.IEEETable, z.buf[:i+1])
 
@@ -170,9 +284,31 @@ func (z *Reader) readString() (string, error) {
 	}
 }
 
-// readHeader reads the GZIP header according to section 2.3.1.
+// readHeader reads the GZIP header according to section 2.3.1,
+// and starts decompressing the member.
 // This method does not set z.err.
 func (z *Reader) readHeader() (hdr Header, err error) {
+	if hdr, err = z.parseHeader(); err != nil {
+		return hdr, err
+	}
+	z.digest = 0
+	if z.decompressor == nil {
+		z.decompressor = flate.NewReader(z.r)
+	} else {
+		z.decompressor.(flate.Resetter).Reset(z.r, nil)
+	}
+	z.member.Header = hdr
+	if z.headerFunc != nil {
+		z.headerFunc(z.member)
+	}
+	return hdr, nil
+}
+
+// parseHeader reads the GZIP header, leaving z.r positioned
+// at the compressed data.
+func (z *Reader) parseHeader() (hdr Header, err error) {
+	z.member = Member{Offset: z.offset()}
+	z.hdrLen = 10
 	if _, err = io.ReadFull(z.r, z.buf[:10]); err != nil {
 		// RFC 1952, section 2.2, says the following:
 		//	A gzip file consists of a series of "members" (compressed data sets).
@@ -187,8 +323,10 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 		return hdr, ErrHeader
 	}
 	flg := z.buf[3]
+	hdr.Text = flg&flagText != 0
+	hdr.HeaderCRC = flg&flagHdrCrc != 0
 	hdr.ModTime = time.Unix(int64(le.Uint32(z.buf[4:8])), 0)
-	// z.buf[8] is XFL and is currently ignored.
+	hdr.XFL = z.buf[8]
 	hdr.OS = z.buf[9]
 	z.digest = crc32.ChecksumIEEE(z.buf[:10])
 
@@ -203,6 +341,7 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 		}
 		z.digest = crc32.Update(z.digest, crc32.IEEETable, data)
 		hdr.Extra = data
+		z.hdrLen += 2 + int64(len(data))
 	}
 
 	var s string
@@ -228,13 +367,7 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 		if digest != uint16(z.digest) {
 			return hdr, ErrHeader
 		}
-	}
-
-	z.digest = 0
-	if z.decompressor == nil {
-		z.decompressor = flate.NewReader(z.r)
-	} else {
-		z.decompressor.(flate.Resetter).Reset(z.r, nil)
+		z.hdrLen += 2
 	}
 	return hdr, nil
 }
@@ -242,28 +375,33 @@ func (z *Reader) readHeader() (hdr Header, err error) {
 // Read implements io.Reader, reading uncompressed bytes from its underlying Reader.
 func (z *Reader) Read(p []byte) (n int, err error) {
 	if z.err != nil {
-		return 0, z.err
+		if !z.resuming {
+			return 0, z.err
+		}
+		if z.resume(); z.err != nil {
+			return 0, z.err
+		}
 	}
 
 	n, z.err = z.decompressor.Read(p)
 	z.digest = crc32.Update(z.digest, crc32.IEEETable, p[:n])
 	z.size += uint32(n)
+	z.member.UncompressedSize += int64(n)
 	if z.err != io.EOF {
 		// In the normal case we return here.
-		return n, z.err
+		return n, z.fail(z.err)
 	}
 
 	// Finished file; check checksum and size.
 	if _, err := io.ReadFull(z.r, z.buf[:8]); err != nil {
-		z.err = noEOF(err)
-		return n, z.err
+		return n, z.fail(noEOF(err))
 	}
 	digest := le.Uint32(z.buf[:4])
 	size := le.Uint32(z.buf[4:8])
 	if digest != z.digest || size != z.size {
-		z.err = ErrChecksum
-		return n, z.err
+		return n, z.fail(ErrChecksum)
 	}
+	z.memberDone()
 	z.digest, z.size = 0, 0
 
 	// File is ok; check if there is another.
@@ -272,8 +410,8 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 	}
 	z.err = nil // Remove io.EOF
 
-	if _, z.err = z.readHeader(); z.err != nil {
-		return n, z.err
+	if _, err := z.readHeader(); err != nil {
+		return n, z.fail(err)
 	}
 
 	// Read from next file, if necessary.
@@ -288,6 +426,10 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 	total := int64(0)
 	crcWriter := crc32.NewIEEE()
 	for {
+		if z.resuming {
+			z.resume()
+			crcWriter.Reset()
+		}
 		if z.err != nil {
 			if z.err == io.EOF {
 				return total, nil
@@ -300,9 +442,9 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 		n, err := z.decompressor.(io.WriterTo).WriteTo(mw)
 		total += n
 		z.size += uint32(n)
+		z.member.UncompressedSize += n
 		if err != nil {
-			z.err = err
-			return total, z.err
+			return total, z.fail(err)
 		}
 
 		// Finished file; check checksum + size.
@@ -310,16 +452,15 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			z.err = err
-			return total, err
+			return total, z.fail(err)
 		}
 		z.digest = crcWriter.Sum32()
 		digest := le.Uint32(z.buf[:4])
 		size := le.Uint32(z.buf[4:8])
 		if digest != z.digest || size != z.size {
-			z.err = ErrChecksum
-			return total, z.err
+			return total, z.fail(ErrChecksum)
 		}
+		z.memberDone()
 		z.digest, z.size = 0, 0
 
 		// File is ok; check if there is another.
@@ -329,11 +470,12 @@ func (z *Reader) WriteTo(w io.Writer) (int64, error) {
 		crcWriter.Reset()
 		z.err = nil // Remove io.EOF
 
-		if _, z.err = z.readHeader(); z.err != nil {
-			if z.err == io.EOF {
+		if _, err := z.readHeader(); err != nil {
+			if err == io.EOF {
+				z.err = err
 				return total, nil
 			}
-			return total, z.err
+			return total, z.fail(err)
 		}
 	}
 }
@@ -8,6 +8,8 @@ import (
 	"bytes"
 	oldgz "compress/gzip"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -16,6 +18,7 @@ import (
 	"time"
 
 	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/crc32"
 )
 
 type gunzipTest struct {
@@ -555,6 +558,365 @@ func TestWriteTo(t *testing.T) {
 	}
 }
 
+func TestHandleMembers(t *testing.T) {
+	var compressed bytes.Buffer
+	var want []Member
+	for i, name := range []string{"a.log", "b.log", "c.log"} {
+		data := strings.Repeat(name+"\n", 1000*(i+1))
+		w := NewWriter(&compressed)
+		w.Name = name
+		w.Comment = "rotated"
+		w.Extra = []byte{'X', 'Y', 1, 0, 'z'}
+		w.ModTime = time.Unix(int64(1e9+i), 0)
+		offset := int64(compressed.Len())
+		w.Write([]byte(data))
+		w.Close()
+		want = append(want, Member{
+			Header:           w.Header,
+			Offset:           offset,
+			Size:             int64(compressed.Len()) - offset,
+			UncompressedSize: int64(len(data)),
+			CRC32:            crc32.ChecksumIEEE([]byte(data)),
+		})
+	}
+
+	for _, tc := range []struct {
+		name string
+		fn   func(io.Writer, io.Reader) (int64, error)
+	}{
+		{"Read", func(w io.Writer, r io.Reader) (int64, error) { return io.Copy(w, ioutil.NopCloser(r)) }},
+		{"WriteTo", io.Copy},
+	} {
+		// Use a reader without ReadByte, so the Reader buffers.
+		r, err := NewReader(ioutil.NopCloser(bytes.NewReader(compressed.Bytes())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var headers, trailers []Member
+		r.HandleMembers(func(m Member) {
+			headers = append(headers, m)
+		}, func(m Member) {
+			trailers = append(trailers, m)
+		})
+		if _, err := tc.fn(ioutil.Discard, r); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(headers) != len(want) || len(trailers) != len(want) {
+			t.Fatalf("%s: got %d headers and %d trailers, want %d", tc.name, len(headers), len(trailers), len(want))
+		}
+		for i, m := range trailers {
+			h := headers[i]
+			if h.Name != want[i].Name || !h.ModTime.Equal(want[i].ModTime) || h.Offset != want[i].Offset {
+				t.Errorf("%s: header %d = %q %v at %d, want %q %v at %d", tc.name, i, h.Name, h.ModTime, h.Offset, want[i].Name, want[i].ModTime, want[i].Offset)
+			}
+			if m.Name != want[i].Name || m.Comment != want[i].Comment || !bytes.Equal(m.Extra, want[i].Extra) ||
+				m.Offset != want[i].Offset || m.Size != want[i].Size ||
+				m.UncompressedSize != want[i].UncompressedSize || m.CRC32 != want[i].CRC32 {
+				t.Errorf("%s: trailer %d = %+v, want %+v", tc.name, i, m, want[i])
+			}
+		}
+	}
+}
+
+// bgzfMember compresses data into a BGZF block.
+func bgzfMember(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	le.PutUint16(b[16:], uint16(len(b)-1))
+	return b
+}
+
+func TestConcurrentReader(t *testing.T) {
+	var plain, bgzf, want bytes.Buffer
+	for i := 0; i < 40; i++ {
+		data := []byte(strings.Repeat(fmt.Sprintf("line %d of member %d\n", i*7, i), 200+i*50))
+		want.Write(data)
+		w := NewWriter(&plain)
+		w.Name = fmt.Sprintf("m%d", i)
+		w.Write(data)
+		w.Close()
+		bgzf.Write(bgzfMember(t, data))
+	}
+	bgzf.Write(bgzfMember(t, nil)) // end of file marker
+
+	// BGZF blocks followed by a regular member.
+	mixed := append(append([]byte{}, bgzf.Bytes()...), plain.Bytes()...)
+	wantMixed := append(append([]byte{}, want.Bytes()...), want.Bytes()...)
+
+	for _, tc := range []struct {
+		name      string
+		in, want  []byte
+		blockSize int
+		header    string
+	}{
+		{"plain", plain.Bytes(), want.Bytes(), 0, "m0"},
+		{"plain-small", plain.Bytes(), want.Bytes(), 1000, "m0"},
+		{"bgzf", bgzf.Bytes(), want.Bytes(), 0, ""},
+		{"bgzf-small", bgzf.Bytes(), want.Bytes(), 1000, ""},
+		{"mixed", mixed, wantMixed, 0, ""},
+	} {
+		for _, writeTo := range []bool{false, true} {
+			r, err := NewConcurrentReader(bytes.NewReader(tc.in), tc.blockSize, 3)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			if r.Name != tc.header {
+				t.Errorf("%s: Name = %q, want %q", tc.name, r.Name, tc.header)
+			}
+			var got bytes.Buffer
+			if writeTo {
+				_, err = r.WriteTo(&got)
+			} else {
+				_, err = io.Copy(&got, ioutil.NopCloser(r))
+			}
+			if err != nil {
+				t.Errorf("%s, WriteTo %v: %v", tc.name, writeTo, err)
+			} else if !bytes.Equal(got.Bytes(), tc.want) {
+				t.Errorf("%s, WriteTo %v: got %d bytes, want %d", tc.name, writeTo, got.Len(), len(tc.want))
+			}
+			r.Close()
+		}
+	}
+}
+
+func TestConcurrentReaderErrors(t *testing.T) {
+	var plain, bgzf bytes.Buffer
+	data := bytes.Repeat([]byte("hello, world\n"), 1000)
+	for i := 0; i < 10; i++ {
+		w := NewWriter(&plain)
+		w.Write(data)
+		w.Close()
+		bgzf.Write(bgzfMember(t, data))
+	}
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		pos  int // byte to corrupt
+	}{
+		{"plain-crc", plain.Bytes(), plain.Len()/2 - 8},
+		{"plain-truncated", plain.Bytes()[:plain.Len()-3], -1},
+		{"bgzf-crc", bgzf.Bytes(), bgzf.Len()/2 - 8},
+		{"bgzf-truncated", bgzf.Bytes()[:bgzf.Len()-3], -1},
+	} {
+		in := append([]byte{}, tc.in...)
+		if tc.pos >= 0 {
+			in[tc.pos] ^= 0xff
+		}
+		r, err := NewConcurrentReader(bytes.NewReader(in), 4096, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err == nil {
+			t.Errorf("%s: no error", tc.name)
+		}
+		r.Close()
+	}
+
+	// A BGZF block whose size covers bytes past its member, ending with
+	// a fake uncompressed size. The member data must not be padded.
+	bad := bgzfMember(t, []byte("hello"))
+	le.PutUint16(bad[16:], uint16(len(bad)+4-1))
+	bad = append(bad, 0, 0x10, 0, 0)
+	r, err := NewConcurrentReader(bytes.NewReader(bad), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); string(got) != "hello" || err != io.ErrUnexpectedEOF {
+		t.Errorf("oversized BGZF block: got %d bytes, %v; want %q, %v", len(got), err, "hello", io.ErrUnexpectedEOF)
+	}
+	r.Close()
+
+	// Closing before the end must not block.
+	r, err = NewConcurrentReader(bytes.NewReader(bgzf.Bytes()), 1024, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b [10]byte
+	if _, err := r.Read(b[:]); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := r.Read(b[:]); err != errClosed {
+		t.Errorf("Read after Close: %v, want %v", err, errClosed)
+	}
+
+	if _, err := NewConcurrentReader(strings.NewReader("not gzip data"), 0, 0); err != ErrHeader {
+		t.Errorf("NewConcurrentReader: %v, want %v", err, ErrHeader)
+	}
+}
+
+func TestLenient(t *testing.T) {
+	var compressed bytes.Buffer
+	var members [][]byte
+	var offsets []int64
+	for i := 0; i < 3; i++ {
+		data := []byte(strings.Repeat(fmt.Sprintf("member %d\n", i), 5000))
+		members = append(members, data)
+		offsets = append(offsets, int64(compressed.Len()))
+		w := NewWriter(&compressed)
+		w.Write(data)
+		w.Close()
+	}
+	end := int64(compressed.Len())
+
+	for _, tc := range []struct {
+		name   string
+		damage func([]byte) []byte
+		cause  error
+		offset int64 // of the damage
+		want   []byte
+	}{
+		{
+			name:   "checksum",
+			damage: func(b []byte) []byte { b[offsets[1]-8] ^= 1; return b },
+			cause:  ErrChecksum,
+			offset: offsets[1] - 8,
+			want:   bytes.Join(members, nil),
+		},
+		{
+			name:   "truncated",
+			damage: func(b []byte) []byte { return b[:end-3] },
+			cause:  io.ErrUnexpectedEOF,
+			offset: end - 3,
+			want:   bytes.Join(members, nil),
+		},
+		{
+			name:   "garbage",
+			damage: func(b []byte) []byte { return append(b[:end:end], "trailing garbage, long enough"...) },
+			cause:  ErrHeader,
+			offset: end + 10,
+			want:   bytes.Join(members, nil),
+		},
+		{
+			name: "corrupt",
+			damage: func(b []byte) []byte {
+				mid := (offsets[1] + offsets[2]) / 2
+				copy(b[mid:mid+20], bytes.Repeat([]byte{0xff}, 20))
+				return b
+			},
+			cause: flate.CorruptInputError(0),
+			want:  nil, // Garbage may be returned from the second member.
+		},
+	} {
+		for i := 0; i < 4; i++ {
+			resync, writeTo := i&1 != 0, i&2 != 0
+			copyAll := func(w io.Writer, r io.Reader) (int64, error) {
+				if writeTo {
+					return io.Copy(w, r)
+				}
+				return io.Copy(w, ioutil.NopCloser(r))
+			}
+			in := tc.damage(append([]byte{}, compressed.Bytes()...))
+			r, err := NewReader(bytes.NewReader(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Lenient(resync)
+			var got bytes.Buffer
+			_, err = copyAll(&got, r)
+			re, ok := err.(*RecoveryError)
+			if !ok {
+				t.Errorf("%s: got error %v, want *RecoveryError", tc.name, err)
+				continue
+			}
+			if _, corrupt := tc.cause.(flate.CorruptInputError); corrupt {
+				if _, ok := re.Err.(flate.CorruptInputError); !ok && re.Err != io.ErrUnexpectedEOF {
+					t.Errorf("%s: cause %v, want corrupt input", tc.name, re.Err)
+				}
+				if re.Member != offsets[1] || re.Offset < (offsets[1]+offsets[2])/2 || re.Offset > offsets[2] {
+					t.Errorf("%s: damage at %d in member at %d", tc.name, re.Offset, re.Member)
+				}
+			} else if !errors.Is(err, tc.cause) || re.Offset != tc.offset {
+				t.Errorf("%s: got %v at %d, want %v at %d", tc.name, re.Err, re.Offset, tc.cause, tc.offset)
+			}
+			if !resync {
+				if _, err := r.Read(make([]byte, 10)); err != re {
+					t.Errorf("%s: error after damage %v, want %v", tc.name, err, re)
+				}
+				continue
+			}
+			// Continue after the damage.
+			for err != nil && err != io.EOF {
+				_, err = copyAll(&got, r)
+				if err == nil {
+					err = io.EOF
+				}
+				if _, ok := err.(*RecoveryError); !ok && err != io.EOF {
+					t.Fatalf("%s: resync error %v", tc.name, err)
+				}
+			}
+			if tc.want == nil {
+				if !bytes.HasPrefix(got.Bytes(), members[0]) || !bytes.HasSuffix(got.Bytes(), members[2]) {
+					t.Errorf("%s: first and last member not recovered", tc.name)
+				}
+			} else if !bytes.Equal(got.Bytes(), tc.want) {
+				t.Errorf("%s: recovered %d bytes, want %d", tc.name, got.Len(), len(tc.want))
+			}
+		}
+	}
+}
+
+func TestStatVerify(t *testing.T) {
+	data := bytes.Repeat([]byte("scrub me\n"), 300000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "data.txt"
+	w.ModTime = time.Unix(1e9, 0)
+	w.Write(data)
+	w.Close()
+	in := buf.Bytes()
+
+	m, err := Stat(bytes.NewReader(in), int64(len(in)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "data.txt" || !m.ModTime.Equal(w.ModTime) || m.Size != int64(len(in)) ||
+		m.UncompressedSize != int64(len(data)) || m.CRC32 != crc32.ChecksumIEEE(data) {
+		t.Errorf("Stat = %+v", m)
+	}
+	if _, err := Stat(bytes.NewReader(in[:15]), 15); err != io.ErrUnexpectedEOF {
+		t.Errorf("Stat of truncated file: %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if _, err := Stat(strings.NewReader("not gzip data"), 13); err != ErrHeader {
+		t.Errorf("Stat of invalid file: %v, want %v", err, ErrHeader)
+	}
+
+	var calls int
+	var lastIn, lastOut int64
+	n, err := Verify(bytes.NewReader(in), func(in, out int64) {
+		if in < lastIn || out < lastOut {
+			t.Errorf("progress went back from %d, %d to %d, %d", lastIn, lastOut, in, out)
+		}
+		calls++
+		lastIn, lastOut = in, out
+	})
+	if err != nil || n != int64(len(data)) {
+		t.Errorf("Verify = %d, %v; want %d, nil", n, err, len(data))
+	}
+	if calls < 2 || lastIn != int64(len(in)) || lastOut != int64(len(data)) {
+		t.Errorf("%d progress calls, last %d, %d", calls, lastIn, lastOut)
+	}
+	// The pooled Reader no longer refers to the input.
+	if v, _ := verifiers.Get().(*verifier); v != nil {
+		if v.z.r != nil || v.z.cr != nil || v.br.Buffered() != 0 {
+			t.Error("pooled Reader still refers to the input")
+		}
+		verifiers.Put(v)
+	}
+
+	bad := append([]byte{}, in...)
+	bad[len(bad)-5] ^= 1
+	if _, err := Verify(bytes.NewReader(bad), nil); err != ErrChecksum {
+		t.Errorf("Verify of bad file: %v, want %v", err, ErrChecksum)
+	}
+}
+
 func TestNilStream(t *testing.T) {
 	// Go liberally interprets RFC 1952 section 2.2 to mean that a gzip file
 	// consist of zero or more members. Thus, we test that a nil stream is okay.
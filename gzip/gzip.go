@@ -36,6 +36,7 @@ type Writer struct {
 	size        uint32 // Uncompressed size (section 2.3.1)
 	closed      bool
 	buf         [10]byte
+	hdrDigest   uint32 // CRC-32 of the header written so far, for FHCRC
 	err         error
 }
 
@@ -90,18 +91,25 @@ func (z *Writer) Reset(w io.Writer) {
 	z.init(w, z.level)
 }
 
+// writeHeader writes a part of the header to z.w,
+// adding it to the header digest.
+func (z *Writer) writeHeader(b []byte) error {
+	z.hdrDigest = crc32.Update(z.hdrDigest, crc32.IEEETable, b)
+	_, err := z.w.Write(b)
+	return err
+}
+
 // writeBytes writes a length-prefixed byte slice to z.w.
 func (z *Writer) writeBytes(b []byte) error {
 	if len(b) > 0xffff {
 		return errors.New("gzip.Write: Extra data is too large")
 	}
 	le.PutUint16(z.buf[:2], uint16(len(b)))
-	_, err := z.w.Write(z.buf[:2])
+	err := z.writeHeader(z.buf[:2])
 	if err != nil {
 		return err
 	}
-	_, err = z.w.Write(b)
-	return err
+	return z.writeHeader(b)
 }
 
 // writeString writes a UTF-8 string s in GZIP's format to z.w.
@@ -122,17 +130,77 @@ func (z *Writer) writeString(s string) (err error) {
 		for _, v := range s {
 			b = append(b, byte(v))
 		}
-		_, err = z.w.Write(b)
+		err = z.writeHeader(b)
 	} else {
-		_, err = io.WriteString(z.w, s)
+		err = z.writeHeader([]byte(s))
 	}
 	if err != nil {
 		return err
 	}
 	// GZIP strings are NUL-terminated.
 	z.buf[0] = 0
-	_, err = z.w.Write(z.buf[:1])
-	return err
+	return z.writeHeader(z.buf[:1])
+}
+
+// writeMemberHeader writes the GZIP header according to section 2.3.1,
+// from z.Header.
+func (z *Writer) writeMemberHeader() error {
+	z.buf[0] = gzipID1
+	z.buf[1] = gzipID2
+	z.buf[2] = gzipDeflate
+	z.buf[3] = 0
+	if z.Text {
+		z.buf[3] |= flagText
+	}
+	if z.HeaderCRC {
+		z.buf[3] |= flagHdrCrc
+	}
+	if z.Extra != nil {
+		z.buf[3] |= 0x04
+	}
+	if z.Name != "" {
+		z.buf[3] |= 0x08
+	}
+	if z.Comment != "" {
+		z.buf[3] |= 0x10
+	}
+	le.PutUint32(z.buf[4:8], uint32(z.ModTime.Unix()))
+	if z.XFL != 0 {
+		z.buf[8] = z.XFL
+	} else if z.level == BestCompression {
+		z.buf[8] = 2
+	} else if z.level == BestSpeed {
+		z.buf[8] = 4
+	} else {
+		z.buf[8] = 0
+	}
+	z.buf[9] = z.OS
+	z.hdrDigest = 0
+	if err := z.writeHeader(z.buf[:10]); err != nil {
+		return err
+	}
+	if z.Extra != nil {
+		if err := z.writeBytes(z.Extra); err != nil {
+			return err
+		}
+	}
+	if z.Name != "" {
+		if err := z.writeString(z.Name); err != nil {
+			return err
+		}
+	}
+	if z.Comment != "" {
+		if err := z.writeString(z.Comment); err != nil {
+			return err
+		}
+	}
+	if z.HeaderCRC {
+		le.PutUint16(z.buf[:2], uint16(z.hdrDigest))
+		if _, err := z.w.Write(z.buf[:2]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Write writes a compressed form of p to the underlying io.Writer. The
@@ -145,50 +213,9 @@ func (z *Writer) Write(p []byte) (int, error) {
 	// Write the GZIP header lazily.
 	if !z.wroteHeader {
 		z.wroteHeader = true
-		z.buf[0] = gzipID1
-		z.buf[1] = gzipID2
-		z.buf[2] = gzipDeflate
-		z.buf[3] = 0
-		if z.Extra != nil {
-			z.buf[3] |= 0x04
-		}
-		if z.Name != "" {
-			z.buf[3] |= 0x08
-		}
-		if z.Comment != "" {
-			z.buf[3] |= 0x10
-		}
-		le.PutUint32(z.buf[4:8], uint32(z.ModTime.Unix()))
-		if z.level == BestCompression {
-			z.buf[8] = 2
-		} else if z.level == BestSpeed {
-			z.buf[8] = 4
-		} else {
-			z.buf[8] = 0
-		}
-		z.buf[9] = z.OS
-		n, z.err = z.w.Write(z.buf[:10])
-		if z.err != nil {
+		if z.err = z.writeMemberHeader(); z.err != nil {
 			return n, z.err
 		}
-		if z.Extra != nil {
-			z.err = z.writeBytes(z.Extra)
-			if z.err != nil {
-				return n, z.err
-			}
-		}
-		if z.Name != "" {
-			z.err = z.writeString(z.Name)
-			if z.err != nil {
-				return n, z.err
-			}
-		}
-		if z.Comment != "" {
-			z.err = z.writeString(z.Comment)
-			if z.err != nil {
-				return n, z.err
-			}
-		}
 		if z.compressor == nil {
 			z.compressor, _ = flate.NewWriter(z.w, z.level)
 		}
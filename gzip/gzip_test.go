@@ -84,6 +84,95 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+// TestHeaderFlags tests that FTEXT, FHCRC and XFL are written and read,
+// and that the header CRC is verified.
+func TestHeaderFlags(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, _ := NewWriterLevel(buf, BestSpeed)
+	w.Name = "name"
+	w.Comment = "comment"
+	w.Text = true
+	w.HeaderCRC = true
+	if _, err := w.Write([]byte("payload")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close: %v", err)
+	}
+	// The standard library verifies the header CRC too.
+	if _, err := oldgz.NewReader(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("compress/gzip: %v", err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if !r.Text || !r.HeaderCRC || r.XFL != 4 {
+		t.Errorf("got Text %v, HeaderCRC %v, XFL %d; want true, true, 4", r.Text, r.HeaderCRC, r.XFL)
+	}
+	if b, err := ioutil.ReadAll(r); err != nil || string(b) != "payload" {
+		t.Errorf("ReadAll: %q, %v", b, err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		pos  int
+		bit  byte
+	}{
+		{"crc", 10 + len("name\x00comment\x00"), 1},
+		{"name", 12, 1},
+	} {
+		b := append([]byte{}, buf.Bytes()...)
+		b[tc.pos] ^= tc.bit
+		if _, err := NewReader(bytes.NewReader(b)); err != ErrHeader {
+			t.Errorf("%s: got %v, want %v", tc.name, err, ErrHeader)
+		}
+	}
+
+	// An explicit XFL is written as is.
+	buf.Reset()
+	w.Reset(buf)
+	w.XFL = 2
+	w.Close()
+	if buf.Bytes()[8] != 2 {
+		t.Errorf("XFL = %d, want 2", buf.Bytes()[8])
+	}
+}
+
+func TestExtraSubfields(t *testing.T) {
+	var h Header
+	if err := h.SetExtraSubfield('A', 'B', []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	h.SetExtraSubfield('C', 'D', []byte{})
+	h.SetExtraSubfield('A', 'B', []byte("two"))
+	if want := "AB\x03\x00twoCD\x00\x00"; string(h.Extra) != want {
+		t.Errorf("Extra = %q, want %q", h.Extra, want)
+	}
+	if data, ok := h.ExtraSubfield('C', 'D'); !ok || len(data) != 0 {
+		t.Errorf("ExtraSubfield(C, D) = %q, %v", data, ok)
+	}
+	if _, ok := h.ExtraSubfield('X', 'Y'); ok {
+		t.Errorf("ExtraSubfield(X, Y) found")
+	}
+	fields, err := h.ExtraSubfields()
+	if err != nil || len(fields) != 2 || fields[0].ID != [2]byte{'A', 'B'} || string(fields[0].Data) != "two" {
+		t.Errorf("ExtraSubfields = %q, %v", fields, err)
+	}
+	h.SetExtraSubfield('A', 'B', nil)
+	if want := "CD\x00\x00"; string(h.Extra) != want {
+		t.Errorf("Extra = %q, want %q", h.Extra, want)
+	}
+
+	h.Extra = []byte("extra")
+	if _, err := h.ExtraSubfields(); err == nil {
+		t.Errorf("ExtraSubfields accepted %q", h.Extra)
+	}
+	if err := h.SetExtraSubfield('A', 'B', nil); err == nil {
+		t.Errorf("SetExtraSubfield accepted %q", h.Extra)
+	}
+}
+
 // TestLatin1 tests the internal functions for converting to and from Latin-1.
 func TestLatin1(t *testing.T) {
 	latin1 := []byte{0xc4, 'u', 0xdf, 'e', 'r', 'u', 'n', 'g', 0}
@@ -0,0 +1,129 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"hash"
+	"io"
+
+	"github.com/klauspost/compress/checksum"
+	"github.com/klauspost/compress/internal/splice"
+	"github.com/klauspost/crc32"
+)
+
+// Concat writes to w a single-member gzip stream with the header hdr,
+// holding the uncompressed data of all members of the gzip streams read
+// from rs, in order, without recompressing it.
+//
+// The compressed data of the members is copied as is, except that the
+// last block of all but the last member is no longer marked final, and is
+// followed by an empty stored block to realign the next member on a byte
+// boundary. The data of the members is decompressed to locate their
+// blocks, and their CRC-32 and size are verified. The CRC-32 of the
+// result is combined from theirs.
+func Concat(w io.Writer, hdr Header, rs ...io.Reader) error {
+	zw := Writer{Header: hdr, w: w}
+	if err := zw.writeMemberHeader(); err != nil {
+		return err
+	}
+	j := splice.NewJoiner(w, crcChecksum)
+	var crc uint32
+	var size int64
+	var trailer [8]byte
+	for _, r := range rs {
+		z := Reader{r: bufio.NewReader(r)}
+		for {
+			if _, err := z.parseHeader(); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			sum, n, err := j.Stream(z.r)
+			if err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(z.r, trailer[:]); err != nil {
+				return noEOF(err)
+			}
+			if le.Uint32(trailer[:4]) != sum || le.Uint32(trailer[4:8]) != uint32(n) {
+				return ErrChecksum
+			}
+			crc = checksum.CombineCRC32(crc32.IEEE, crc, sum, n)
+			size += n
+		}
+	}
+	if err := j.Close(); err != nil {
+		return err
+	}
+	return writeTrailer(w, crc, size)
+}
+
+// Split splits the members of the gzip stream read from r into
+// independent gzip members at their full-flush points, without
+// recompressing them. A full-flush point is a block boundary on a byte
+// boundary, such as those written by Concat, across which the data does
+// not refer back; those written by Writer.Flush usually do not qualify.
+//
+// A member is only cut once it holds at least minSize bytes of
+// uncompressed data. For every new member, Split calls next with its
+// header, copied from the member it was cut from, and writes it to the
+// returned io.Writer. Cut members end with an empty final block.
+//
+// As it must decode up to 32KB past a full-flush point to tell whether
+// the data refers back across it, Split keeps the compressed data of
+// that range in memory. The CRC-32 and size of each member of r are
+// verified.
+func Split(r io.Reader, minSize int64, next func(Header) (io.Writer, error)) error {
+	var hdr Header
+	s := splice.NewSplitter(minSize, crcChecksum, func() (io.Writer, error) {
+		w, err := next(hdr)
+		if err != nil {
+			return nil, err
+		}
+		zw := Writer{Header: hdr, w: w}
+		return w, zw.writeMemberHeader()
+	}, writeTrailer)
+	z := Reader{r: bufio.NewReader(r)}
+	var trailer [8]byte
+	for {
+		var err error
+		hdr, err = z.parseHeader()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		crc, size, err := s.Stream(z.r)
+		if err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(z.r, trailer[:]); err != nil {
+			return noEOF(err)
+		}
+		if le.Uint32(trailer[:4]) != crc || le.Uint32(trailer[4:8]) != uint32(size) {
+			return ErrChecksum
+		}
+	}
+}
+
+// crcChecksum is the checksum of gzip trailers.
+var crcChecksum = splice.Checksum{
+	New: func() hash.Hash32 { return crc32.NewIEEE() },
+	Combine: func(crc1, crc2 uint32, len2 int64) uint32 {
+		return checksum.CombineCRC32(crc32.IEEE, crc1, crc2, len2)
+	},
+}
+
+// writeTrailer writes the trailer of a member with the given CRC-32 and size.
+func writeTrailer(w io.Writer, crc uint32, size int64) error {
+	var trailer [8]byte
+	le.PutUint32(trailer[:4], crc)
+	le.PutUint32(trailer[4:8], uint32(size))
+	_, err := w.Write(trailer[:])
+	return err
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func compressLevel(t *testing.T, data []byte, level int) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// joinInputs returns parts of a text file, compressed at various levels,
+// so that their last blocks end at various bit positions.
+func joinInputs(t *testing.T) (parts [][]byte, compressed []io.Reader) {
+	data, err := ioutil.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := []int{NoCompression, BestSpeed, 2, 3, 4, DefaultCompression, 6, 7, 8, BestCompression, HuffmanOnly, ConstantCompression}
+	for i, n := 0, 1; len(data) > 0; i, n = i+1, n*3+17 {
+		if n > len(data) {
+			n = len(data)
+		}
+		parts = append(parts, data[:n])
+		compressed = append(compressed, bytes.NewReader(compressLevel(t, data[:n], levels[i%len(levels)])))
+		data = data[n:]
+	}
+	return parts, compressed
+}
+
+func TestConcatSingleMember(t *testing.T) {
+	parts, compressed := joinInputs(t)
+	// A multistream input is joined too, and empty inputs are skipped.
+	multi := append(compressLevel(t, []byte("hello, "), BestSpeed), compressLevel(t, []byte("world\n"), BestCompression)...)
+	compressed = append(compressed, bytes.NewReader(nil), bytes.NewReader(multi))
+	want := append(bytes.Join(parts, nil), "hello, world\n"...)
+
+	var buf bytes.Buffer
+	hdr := Header{Name: "joined.txt", ModTime: time.Unix(1e9, 0), OS: 3, HeaderCRC: true}
+	if err := Concat(&buf, hdr, compressed...); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z.Multistream(false)
+	got, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+	if z.Name != hdr.Name || !z.ModTime.Equal(hdr.ModTime) || z.OS != hdr.OS {
+		t.Errorf("got header %+v, want %+v", z.Header, hdr)
+	}
+	if err := z.Reset(&buf); err != io.EOF {
+		t.Errorf("got %v after the first member, want io.EOF", err)
+	}
+
+	// No input.
+	buf.Reset()
+	if err := Concat(&buf, Header{}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Verify(&buf, nil); n != 0 || err != nil {
+		t.Errorf("got %d, %v for no input", n, err)
+	}
+
+	// A wrong size or CRC-32 in a trailer.
+	for _, i := range []int{4, 8} {
+		b := compressLevel(t, []byte("hello"), BestSpeed)
+		b[len(b)-i]++
+		if err := Concat(ioutil.Discard, Header{}, bytes.NewReader(b)); err != ErrChecksum {
+			t.Errorf("byte %d from the end: got %v, want %v", i, err, ErrChecksum)
+		}
+	}
+}
+
+// splitAll splits r and returns the members written.
+func splitAll(t *testing.T, r io.Reader, minSize int64) []*bytes.Buffer {
+	var members []*bytes.Buffer
+	err := Split(r, minSize, func(hdr Header) (io.Writer, error) {
+		if hdr.Name != "log.txt" {
+			t.Errorf("got header %+v", hdr)
+		}
+		members = append(members, new(bytes.Buffer))
+		return members[len(members)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return members
+}
+
+func TestSplit(t *testing.T) {
+	parts, compressed := joinInputs(t)
+	var joined bytes.Buffer
+	if err := Concat(&joined, Header{Name: "log.txt"}, compressed...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every joined member ends at a full-flush point.
+	members := splitAll(t, bytes.NewReader(joined.Bytes()), 0)
+	if len(members) != len(parts) {
+		t.Fatalf("got %d members, want %d", len(members), len(parts))
+	}
+	for i, m := range members {
+		z, err := NewReader(m)
+		if err != nil {
+			t.Fatalf("member %d: %v", i, err)
+		}
+		z.Multistream(false)
+		got, err := ioutil.ReadAll(z)
+		if err != nil {
+			t.Fatalf("member %d: %v", i, err)
+		}
+		if !bytes.Equal(got, parts[i]) {
+			t.Errorf("member %d: got %d bytes, want %d", i, len(got), len(parts[i]))
+		}
+	}
+
+	// With a minimum size, members hold several parts.
+	const minSize = 100000
+	members = splitAll(t, bytes.NewReader(joined.Bytes()), minSize)
+	var got []byte
+	for i, m := range members {
+		b, err := ioutil.ReadAll(mustNewReader(t, m))
+		if err != nil {
+			t.Fatalf("member %d: %v", i, err)
+		}
+		if len(b) < minSize && i < len(members)-1 {
+			t.Errorf("member %d: got %d bytes, want at least %d", i, len(b), minSize)
+		}
+		got = append(got, b...)
+	}
+	if len(members) < 2 || !bytes.Equal(got, bytes.Join(parts, nil)) {
+		t.Errorf("got %d members with %d bytes", len(members), len(got))
+	}
+
+	// The sync flush points of Writer.Flush usually refer back, but
+	// members are only cut where they do not.
+	data := bytes.Join(parts, nil)
+	for _, level := range []int{BestSpeed, DefaultCompression, BestCompression} {
+		for _, chunk := range []int{3000, 50000} {
+			var buf bytes.Buffer
+			w, _ := NewWriterLevel(&buf, level)
+			w.Name = "log.txt"
+			for p := data; len(p) > 0; {
+				n := chunk
+				if n > len(p) {
+					n = len(p)
+				}
+				w.Write(p[:n])
+				w.Flush()
+				p = p[n:]
+			}
+			w.Close()
+			members = splitAll(t, &buf, 0)
+			got = got[:0]
+			for i, m := range members {
+				b, err := ioutil.ReadAll(mustNewReader(t, m))
+				if err != nil {
+					t.Fatalf("level %d, chunk %d: member %d: %v", level, chunk, i, err)
+				}
+				got = append(got, b...)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("level %d, chunk %d: got %d members with %d bytes", level, chunk, len(members), len(got))
+			}
+			if level != BestSpeed && chunk > 32<<10 && len(members) != 1 {
+				t.Errorf("level %d, chunk %d: got %d members, want 1", level, chunk, len(members))
+			}
+		}
+	}
+
+	// A wrong checksum.
+	b := joined.Bytes()
+	b[len(b)-8]++
+	if err := Split(bytes.NewReader(b), 0, func(Header) (io.Writer, error) { return ioutil.Discard, nil }); err != ErrChecksum {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+}
+
+func mustNewReader(t *testing.T, r io.Reader) *Reader {
+	z, err := NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// A RecoveryError describes damage found in the input of a Reader in
+// lenient mode. See Reader.Lenient.
+type RecoveryError struct {
+	Member  int64 // Offset of the damaged member in the compressed input
+	Offset  int64 // Offset in the compressed input where the damage was detected
+	Written int64 // Uncompressed bytes of the member returned before the damage
+
+	// Err is the cause: ErrChecksum, ErrHeader, io.ErrUnexpectedEOF
+	// or a flate.CorruptInputError.
+	Err error
+}
+
+func (e *RecoveryError) Error() string {
+	return "gzip: damaged member at offset " + strconv.FormatInt(e.Member, 10) +
+		": " + e.Err.Error() + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+func (e *RecoveryError) Unwrap() error { return e.Err }
+
+// Lenient makes the Reader report damaged input as a *RecoveryError,
+// giving the offset and cause of the damage. This covers invalid
+// checksums and sizes, truncated input, corrupt deflate data and invalid
+// headers of the members following the first. As always, the data
+// decoded up to the damage is returned before the error.
+//
+// If resync is set, reading may continue after a *RecoveryError.
+// The Reader then scans the input from where the damage was detected
+// for the next member header, starting with the bytes 1f 8b 08, and
+// resumes decoding there. Data up to that header is lost, and a false
+// match is reported as another *RecoveryError. Without resync, the
+// error is final.
+//
+// Lenient must be called before the first Read or WriteTo, since the
+// compressed input is counted from there to find offsets. The input
+// may be read ahead of the end of the gzip stream. Reset disables
+// lenient mode.
+func (z *Reader) Lenient(resync bool) {
+	z.countInput()
+	if z.cr != nil && z.br == nil {
+		z.br = bufio.NewReader(z.cr.r)
+		z.cr.r = z.br
+	}
+	z.lenient, z.resync = true, resync
+}
+
+// fail records err as the error of the Reader and returns it.
+// In lenient mode, damage is reported as a *RecoveryError.
+func (z *Reader) fail(err error) error {
+	z.err = err
+	if !z.lenient {
+		return err
+	}
+	var offset int64
+	switch e := err.(type) {
+	case flate.CorruptInputError:
+		// The offset is counted from the start of the deflate data.
+		offset = z.member.Offset + z.hdrLen + int64(e)
+	default:
+		switch err {
+		case ErrChecksum:
+			offset = z.offset() - 8
+		case ErrHeader, io.ErrUnexpectedEOF:
+			offset = z.offset()
+		default:
+			return err
+		}
+	}
+	z.err = &RecoveryError{
+		Member:  z.member.Offset,
+		Offset:  offset,
+		Written: z.member.UncompressedSize,
+		Err:     err,
+	}
+	z.resuming = z.resync && z.br != nil
+	return z.err
+}
+
+// resume continues after a *RecoveryError at the next member header.
+func (z *Reader) resume() {
+	z.resuming = false
+	z.size = 0
+	z.fail(z.resyncHeader())
+}
+
+// resyncHeader scans the input for the next valid member header
+// and reads it.
+func (z *Reader) resyncHeader() error {
+	for {
+		buf, err := z.br.Peek(10)
+		if len(buf) < 10 {
+			// Too short for a member; the rest is lost.
+			z.skip(len(buf))
+			return err
+		}
+		// Valid headers have no reserved flags set.
+		if buf[0] == gzipID1 && buf[1] == gzipID2 && buf[2] == gzipDeflate && buf[3]&flagReserved == 0 {
+			_, err := z.readHeader()
+			if err != ErrHeader {
+				return err
+			}
+			continue
+		}
+		buf, _ = z.br.Peek(z.br.Buffered())
+		i := bytes.IndexByte(buf[1:], gzipID1)
+		if i < 0 {
+			i = len(buf) - 1
+		}
+		z.skip(i + 1)
+	}
+}
+
+// skip discards n bytes of input, counting them as read.
+func (z *Reader) skip(n int) {
+	n, _ = z.br.Discard(n)
+	z.cr.n += int64(n)
+}
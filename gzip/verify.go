@@ -0,0 +1,109 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Stat reads the header and trailer of the single-member gzip file
+// of the given size in r, without decompressing it.
+//
+// The returned Member holds the header, the size and the CRC-32 from the
+// trailer. The trailer only records the uncompressed size modulo 2^32,
+// and neither it nor the checksum is verified against the data.
+// For a multistream file, the trailer of the last member is returned
+// with the header of the first. Use Verify to check the data.
+func Stat(r io.ReaderAt, size int64) (Member, error) {
+	z := Reader{r: bufio.NewReader(io.NewSectionReader(r, 0, size))}
+	hdr, err := z.parseHeader()
+	if err != nil {
+		return Member{}, noEOF(err)
+	}
+	// The smallest deflate stream is two bytes.
+	if size < z.hdrLen+2+8 {
+		return Member{}, io.ErrUnexpectedEOF
+	}
+	if _, err := r.ReadAt(z.buf[:8], size-8); err != nil {
+		return Member{}, noEOF(err)
+	}
+	return Member{
+		Header:           hdr,
+		Size:             size,
+		UncompressedSize: int64(le.Uint32(z.buf[4:8])),
+		CRC32:            le.Uint32(z.buf[:4]),
+	}, nil
+}
+
+// progressInterval is the number of uncompressed bytes between
+// calls to the progress function of Verify.
+const progressInterval = 1 << 20
+
+// A verifier holds the Reader and input buffer of Verify, which are
+// reused across calls.
+type verifier struct {
+	z  Reader
+	br *bufio.Reader
+}
+
+var verifiers sync.Pool
+
+// Verify decompresses all members of the gzip data read from r,
+// checking their checksums and sizes, and returns the uncompressed
+// size. The data is discarded as it is decompressed, so only the
+// decompression window is kept in memory, and Readers are reused
+// across calls.
+//
+// If progress is not nil, it is called with the number of compressed
+// bytes read and uncompressed bytes produced so far, every megabyte of
+// output and at the end.
+func Verify(r io.Reader, progress func(in, out int64)) (int64, error) {
+	v, _ := verifiers.Get().(*verifier)
+	if v == nil {
+		v = &verifier{br: bufio.NewReader(r)}
+	} else {
+		v.br.Reset(r)
+	}
+	defer v.release()
+	z := &v.z
+	if err := z.Reset(v.br); err != nil {
+		return 0, err
+	}
+	z.HandleMembers(nil, nil) // to count the input
+	pw := &progressWriter{z: z, fn: progress, next: progressInterval}
+	n, err := z.WriteTo(pw)
+	if progress != nil {
+		progress(z.offset(), n)
+	}
+	return n, err
+}
+
+// release drops the references to the input of the last call, and
+// returns v to the pool.
+func (v *verifier) release() {
+	v.br.Reset(nil)
+	v.z = Reader{decompressor: v.z.decompressor}
+	verifiers.Put(v)
+}
+
+// progressWriter discards the data written to it, reporting
+// the progress of z.
+type progressWriter struct {
+	z    *Reader
+	fn   func(in, out int64)
+	n    int64
+	next int64
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	if w.fn != nil && w.n >= w.next {
+		w.fn(w.z.offset(), w.n)
+		w.next = w.n + progressInterval
+	}
+	return len(p), nil
+}
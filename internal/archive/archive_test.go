@@ -0,0 +1,98 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchAny(t *testing.T) {
+	for _, tt := range []struct {
+		patterns []string
+		name     string
+		want     bool
+	}{
+		{nil, "a", false},
+		{[]string{"*.go"}, "a/b/c.go", true},
+		{[]string{"a/*.go"}, "a/b/c.go", false},
+		{[]string{"a/*/*.go"}, "a/b/c.go", true},
+		{[]string{"x", "c.*"}, "a/b/c.go", true},
+	} {
+		if got := matchAny(tt.patterns, tt.name); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v, want %v", tt.patterns, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLocalName(t *testing.T) {
+	errInsecure := errors.New("insecure")
+	e := &Extractor{ErrInsecurePath: errInsecure}
+	for name, want := range map[string]string{
+		"a/./b/": "a/b",
+		"a/../b": "b",
+		".":      ".",
+		"../a":   "",
+		"/a":     "",
+		`a\b`:    "",
+	} {
+		got, err := e.LocalName(name)
+		if want == "" {
+			if !errors.Is(err, errInsecure) {
+				t.Errorf("LocalName(%q) = %q, %v, want error", name, got, err)
+			}
+			continue
+		}
+		if got != want || err != nil {
+			t.Errorf("LocalName(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+}
+
+func TestWalkFollowLoop(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a/b", "p", "r"} {
+		if err := os.MkdirAll(filepath.Join(dir, name), 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"a/b/x", "p/y", "r/z"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"a/b/up": "..",
+		"a/self": ".",
+		"p/q":    "../r",
+		"r/s":    "../p",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+	var names []string
+	add := func(name string, fi fs.FileInfo) error {
+		names = append(names, name)
+		return nil
+	}
+	w := &Walker{Symlinks: SymlinkFollow, Dir: add, File: add}
+	if err := w.Walk(DirFS(dir)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"a/", "a/b/", "a/b/x",
+		"p/", "p/q/", "p/q/z", "p/y",
+		"r/", "r/s/", "r/s/y", "r/z",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q\nwant %q", names, want)
+	}
+}
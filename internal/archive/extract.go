@@ -0,0 +1,225 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ratioMinSize is the output size below which MaxRatio is not enforced,
+// since small files of repetitive data legitimately compress well.
+const ratioMinSize = 1 << 20
+
+// An Extractor writes the entries of an archive into the directory Dir,
+// making sure they stay inside it.
+//
+// Entries are never written through symbolic links, whether they come
+// from the archive or already exist in Dir. Violations return an
+// *fs.PathError wrapping ErrInsecurePath, and exceeding a limit one
+// wrapping ErrLimit.
+//
+// Files and directories are created with the modes of os.Create and
+// os.MkdirAll, filtered by the umask, until Restore sets their own.
+type Extractor struct {
+	Dir string
+
+	// Symlinks allows link entries pointing inside Dir.
+	Symlinks bool
+
+	// MaxTotalSize and MaxRatio are the limits enforced by LimitWriter.
+	MaxTotalSize int64
+	MaxRatio     float64
+
+	// SkipModes and SkipTimes disable Restore.
+	SkipModes bool
+	SkipTimes bool
+
+	// ErrInsecurePath and ErrLimit are the errors of the archive package.
+	ErrInsecurePath error
+	ErrLimit        error
+
+	// Written counts the bytes written.
+	Written int64
+
+	real map[string]bool // directories known not to be links
+	dirs []dirEntry      // directory entries, to finish last
+}
+
+type dirEntry struct {
+	name  string
+	perm  fs.FileMode
+	mtime time.Time
+}
+
+// LocalName returns the cleaned form of the entry name, or an error
+// if it is absolute, contains backslashes or leaves its directory.
+func (e *Extractor) LocalName(name string) (string, error) {
+	if strings.Contains(name, `\`) || !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", e.insecure(name)
+	}
+	return path.Clean(name), nil
+}
+
+// Target returns the path in Dir of the local name.
+func (e *Extractor) Target(name string) string {
+	return filepath.Join(e.Dir, filepath.FromSlash(name))
+}
+
+// Mkdir creates the directory name, and records it as a real directory.
+func (e *Extractor) Mkdir(name string) error {
+	p := e.Target(name)
+	if err := os.Mkdir(p, 0777); err != nil && !os.IsExist(err) {
+		return err
+	}
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return e.insecure(name)
+	}
+	e.setReal(name)
+	return nil
+}
+
+// CheckParents creates the parent directories of name, and makes sure
+// none of them is a symbolic link.
+func (e *Extractor) CheckParents(name string) error {
+	dir := path.Dir(name)
+	if e.IsReal(dir) {
+		return nil
+	}
+	if err := e.CheckParents(dir); err != nil {
+		return err
+	}
+	return e.Mkdir(dir)
+}
+
+// IsReal reports whether the directory name was created or checked
+// by Mkdir, and so is not a link.
+func (e *Extractor) IsReal(name string) bool {
+	return name == "." || e.real[name]
+}
+
+func (e *Extractor) setReal(name string) {
+	if e.real == nil {
+		e.real = make(map[string]bool)
+	}
+	e.real[name] = true
+}
+
+// Create creates the regular file name at target, replacing an existing
+// regular file. An existing file is removed rather than truncated, since
+// it may be a hard link to a file elsewhere.
+func (e *Extractor) Create(name, target string) (*os.File, error) {
+	if fi, err := os.Lstat(target); err == nil && !fi.Mode().IsRegular() {
+		return nil, e.insecure(name)
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+// CheckLink validates the target link of the link entry name, given
+// relative to the local directory dir, and returns it in its cleaned form.
+func (e *Extractor) CheckLink(name, dir, link string) (string, error) {
+	if !e.Symlinks {
+		return "", e.insecure(name)
+	}
+	// Links are resolved by the OS, so they are created with the target
+	// in its cleaned form. Then ".." only occurs at the start, where it
+	// applies to the real directories of the link itself.
+	link = path.Clean(link)
+	if strings.Contains(link, `\`) || path.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return "", e.insecure(name)
+	}
+	if _, err := e.LocalName(path.Join(dir, link)); err != nil {
+		return "", e.insecure(name)
+	}
+	return link, nil
+}
+
+// AddDir records the metadata of the directory entry name, to restore
+// by FinishDirs.
+func (e *Extractor) AddDir(name string, perm fs.FileMode, mtime time.Time) {
+	e.dirs = append(e.dirs, dirEntry{name, perm, mtime})
+}
+
+// FinishDirs restores directory metadata, deepest first, since writing
+// files into a directory changes its modification time.
+func (e *Extractor) FinishDirs() error {
+	sort.SliceStable(e.dirs, func(i, j int) bool {
+		return len(e.dirs[i].name) > len(e.dirs[j].name)
+	})
+	for _, d := range e.dirs {
+		if err := e.Restore(e.Target(d.name), d.perm, d.mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore sets the permission bits and modification time of target,
+// unless disabled. A perm of 0 keeps the permission bits target was
+// created with.
+func (e *Extractor) Restore(target string, perm fs.FileMode, mtime time.Time) error {
+	if !e.SkipModes && perm.Perm() != 0 {
+		if err := os.Chmod(target, perm.Perm()); err != nil {
+			return err
+		}
+	}
+	if !e.SkipTimes {
+		if err := os.Chtimes(target, time.Now(), mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LimitWriter returns a writer to w for the entry name that enforces the
+// size limits on the bytes actually decompressed. The ratio function
+// returns the output and input sizes MaxRatio is checked against, given
+// the number of bytes written to w so far.
+func (e *Extractor) LimitWriter(w io.Writer, name string, ratio func(n int64) (out, in int64)) io.Writer {
+	return &limitWriter{w: w, e: e, name: name, ratio: ratio}
+}
+
+type limitWriter struct {
+	w     io.Writer
+	e     *Extractor
+	name  string
+	ratio func(n int64) (out, in int64)
+	n     int64
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	w.e.Written += int64(len(p))
+	if w.e.MaxTotalSize > 0 && w.e.Written > w.e.MaxTotalSize {
+		return 0, w.e.limit(w.name)
+	}
+	if w.e.MaxRatio > 0 {
+		if out, in := w.ratio(w.n); out > ratioMinSize && float64(out) > w.e.MaxRatio*float64(in) {
+			return 0, w.e.limit(w.name)
+		}
+	}
+	return w.w.Write(p)
+}
+
+func (e *Extractor) insecure(name string) error {
+	return &fs.PathError{Op: "extract", Path: name, Err: e.ErrInsecurePath}
+}
+
+func (e *Extractor) limit(name string) error {
+	return &fs.PathError{Op: "extract", Path: name, Err: e.ErrLimit}
+}
@@ -0,0 +1,254 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package archive holds the code shared by the zip and targz packages
+// for adding directory trees to archives and for extracting archives
+// safely.
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkMode controls how a Walker handles symbolic links.
+type SymlinkMode int
+
+const (
+	// SymlinkStore passes a link to Walker.Link.
+	SymlinkStore SymlinkMode = iota
+
+	// SymlinkFollow adds the file or directory the link points to.
+	// Links to a directory being walked, which would loop, are skipped.
+	SymlinkFollow
+
+	// SymlinkSkip leaves links out of the archive.
+	SymlinkSkip
+)
+
+// maxFollowDepth limits how many directory links SymlinkFollow will
+// follow within each other, to stop on link loops that walking cannot
+// detect, in file systems whose FileInfo os.SameFile does not handle.
+const maxFollowDepth = 40
+
+// A Walker walks a directory tree in lexical order using fs.WalkDir,
+// and calls Dir, File and Link for the entries to add to an archive.
+// Files that are neither regular files, directories nor links are skipped.
+type Walker struct {
+	// Include and Exclude hold path.Match patterns, matched against the
+	// full slash-separated path if they contain a slash and against the
+	// base name otherwise. If Include is not empty, only files and links
+	// matching one of its patterns are added. Files, links and
+	// directories matching Exclude are left out, and excluded
+	// directories are not walked.
+	Include []string
+	Exclude []string
+
+	// Symlinks selects how symbolic links are handled.
+	Symlinks SymlinkMode
+
+	// Dir is called with the name of each directory, ending in a slash.
+	// If Include is not empty, it is only called for directories with
+	// included entries, just before the first of them.
+	Dir func(name string, fi fs.FileInfo) error
+
+	// File is called for each regular file, with the information of the
+	// file a followed link points to.
+	File func(name string, fi fs.FileInfo) error
+
+	// Link is called for each symbolic link stored.
+	Link func(name string, fi fs.FileInfo, target string) error
+
+	fsys    fs.FS
+	pending []pendingDir // directories waiting for included entries
+}
+
+type pendingDir struct {
+	name string
+	fi   fs.FileInfo
+}
+
+// Walk walks the tree of fsys. Storing links requires fsys to provide
+// a ReadLink method like the one of os.DirFS in recent Go versions.
+func (w *Walker) Walk(fsys fs.FS) error {
+	w.fsys = fsys
+	w.pending = w.pending[:0]
+	return w.walk(".", 0)
+}
+
+func (w *Walker) walk(root string, depth int) error {
+	return fs.WalkDir(w.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if matchAny(w.Exclude, name) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if len(w.Include) == 0 {
+				return w.Dir(name+"/", fi)
+			}
+			w.pending = append(w.pending, pendingDir{name + "/", fi})
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return w.addLink(name, d, depth)
+		}
+		if !d.Type().IsRegular() || !w.included(name) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := w.flush(name); err != nil {
+			return err
+		}
+		return w.File(name, fi)
+	})
+}
+
+func (w *Walker) addLink(name string, d fs.DirEntry, depth int) error {
+	switch w.Symlinks {
+	case SymlinkSkip:
+		return nil
+	case SymlinkFollow:
+		fi, err := fs.Stat(w.fsys, name)
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if loop, err := w.walking(name, fi); loop || err != nil {
+				return err
+			}
+			if depth >= maxFollowDepth {
+				return &fs.PathError{Op: "walk", Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			return w.walk(name, depth+1)
+		}
+		if !fi.Mode().IsRegular() || !w.included(name) {
+			return nil
+		}
+		if err := w.flush(name); err != nil {
+			return err
+		}
+		return w.File(name, fi)
+	}
+	if !w.included(name) {
+		return nil
+	}
+	rl, ok := w.fsys.(interface {
+		ReadLink(name string) (string, error)
+	})
+	if !ok {
+		return &fs.PathError{Op: "readlink", Path: name, Err: errors.ErrUnsupported}
+	}
+	target, err := rl.ReadLink(name)
+	if err != nil {
+		return err
+	}
+	fi, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if err := w.flush(name); err != nil {
+		return err
+	}
+	return w.Link(name, fi, target)
+}
+
+// walking reports whether the directory fi, which the link name points
+// to, is one of the directories being walked, that is the one of a parent
+// of name.
+func (w *Walker) walking(name string, fi fs.FileInfo) (bool, error) {
+	for dir := name; dir != "."; {
+		dir = path.Dir(dir)
+		di, err := fs.Stat(w.fsys, dir)
+		if err != nil {
+			return false, err
+		}
+		if os.SameFile(di, fi) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (w *Walker) included(name string) bool {
+	return len(w.Include) == 0 || matchAny(w.Include, name)
+}
+
+// flush adds the pending parent directories of name. The tree is walked
+// in lexical order, so the other pending directories have no included
+// entries.
+func (w *Walker) flush(name string) error {
+	for _, dir := range w.pending {
+		if strings.HasPrefix(name, dir.name) {
+			if err := w.Dir(dir.name, dir.fi); err != nil {
+				return err
+			}
+		}
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// matchAny reports whether name matches one of patterns.
+// Patterns without a slash are matched against the base name.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		s := name
+		if !strings.Contains(pattern, "/") {
+			s = path.Base(name)
+		}
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalMode returns the mode stored for a file of the given mode when
+// modes are normalized: 0755 for directories and executable files, 0777
+// for links and 0644 for other files.
+func NormalMode(mode fs.FileMode) fs.FileMode {
+	switch {
+	case mode.IsDir():
+		return fs.ModeDir | 0755
+	case mode&fs.ModeSymlink != 0:
+		return fs.ModeSymlink | 0777
+	case mode&0111 != 0:
+		return 0755
+	}
+	return 0644
+}
+
+// DirFS is an os.DirFS that can also read links.
+type DirFS string
+
+func (dir DirFS) Open(name string) (fs.File, error) {
+	return os.DirFS(string(dir)).Open(name)
+}
+
+func (dir DirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	target, err := os.Readlink(filepath.Join(string(dir), filepath.FromSlash(name)))
+	return filepath.ToSlash(target), err
+}
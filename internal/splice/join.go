@@ -0,0 +1,158 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package splice joins and splits DEFLATE streams at block boundaries
+// without recompressing them. It holds the code shared by the Concat and
+// Split functions of the gzip and zlib packages, which add their own
+// headers and trailers.
+package splice
+
+import (
+	"hash"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// windowSize is the largest distance a DEFLATE match can refer back.
+const windowSize = 1 << 15
+
+// emptyFinal is an empty final block with fixed Huffman codes,
+// which ends a DEFLATE stream.
+var emptyFinal = []byte{0x03, 0x00}
+
+// teeReader keeps the bytes read through it.
+type teeReader struct {
+	r   flate.Reader
+	buf []byte
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.buf = append(t.buf, p[:n]...)
+	return n, err
+}
+
+func (t *teeReader) ReadByte() (byte, error) {
+	c, err := t.r.ReadByte()
+	if err == nil {
+		t.buf = append(t.buf, c)
+	}
+	return c, err
+}
+
+// drop discards the first n bytes kept.
+func (t *teeReader) drop(n int) {
+	t.buf = t.buf[:copy(t.buf, t.buf[n:])]
+}
+
+// A Joiner writes the compressed data of several DEFLATE streams as one.
+//
+// The data of the streams is copied as is, except that the last block of
+// all but the last stream is no longer marked final, and is followed by
+// an empty stored block to realign the next stream on a byte boundary.
+type Joiner struct {
+	w   io.Writer
+	h   hash.Hash32
+	dec io.ReadCloser
+	tee teeReader
+	buf []byte
+
+	// The last block of the previous stream, not written yet.
+	tail  []byte
+	final int64 // Offset of its BFINAL bit in tail, in bits
+	end   uint  // Bits of the block in the last byte of tail, or 0 if all
+}
+
+// NewJoiner returns a Joiner writing to w, which computes the checksum
+// sum of the streams.
+func NewJoiner(w io.Writer, sum Checksum) *Joiner {
+	return &Joiner{w: w, h: sum.New(), buf: make([]byte, 32<<10)}
+}
+
+// Stream copies the DEFLATE stream read from r, and returns the checksum
+// and size of its uncompressed data, for the caller to verify. The stream
+// is decompressed to locate its blocks, and r is left positioned after
+// its end.
+func (j *Joiner) Stream(r flate.Reader) (uint32, int64, error) {
+	if j.tail != nil {
+		if err := j.writeTail(false); err != nil {
+			return 0, 0, err
+		}
+	}
+	j.tee = teeReader{r: r, buf: j.tee.buf[:0]}
+	if j.dec == nil {
+		j.dec = flate.NewReader(&j.tee)
+	} else {
+		j.dec.(flate.Resetter).Reset(&j.tee, nil)
+	}
+	// All blocks but the last are written as they are decoded. The
+	// last one is kept in j.tail until it is known whether another
+	// stream follows.
+	var base, safe int64 // Offsets of j.tee.buf and of the last block, in bytes
+	var last flate.Block
+	j.dec.(flate.BlockReporter).ReportBlocks(func(b flate.Block) {
+		if b.Final {
+			last = b
+		} else {
+			safe = b.End / 8
+		}
+	})
+	var n int64
+	j.h.Reset()
+	for {
+		m, err := j.dec.Read(j.buf)
+		j.h.Write(j.buf[:m])
+		n += int64(m)
+		if safe > base {
+			if _, err := j.w.Write(j.tee.buf[:safe-base]); err != nil {
+				return 0, 0, err
+			}
+			j.tee.drop(int(safe - base))
+			base = safe
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	j.tail = j.tee.buf
+	j.final = last.Start - base*8
+	j.end = uint(last.End % 8)
+	return j.h.Sum32(), n, nil
+}
+
+// writeTail writes the last block of the previous stream. Unless final
+// is set, it clears its BFINAL bit and appends an empty stored block,
+// which ends on a byte boundary, so that the next stream can follow.
+func (j *Joiner) writeTail(final bool) error {
+	if !final {
+		j.tail[j.final/8] &^= 1 << uint(j.final%8)
+		if j.end != 0 {
+			// Clear the padding bits, which become the first bits
+			// of the stored block header.
+			j.tail[len(j.tail)-1] &= 1<<j.end - 1
+			if j.end > 5 {
+				// The three header bits do not fit.
+				j.tail = append(j.tail, 0)
+			}
+			j.tail = append(j.tail, 0, 0, 0xff, 0xff)
+		}
+	}
+	_, err := j.w.Write(j.tail)
+	j.tail = nil
+	return err
+}
+
+// Close ends the joined DEFLATE stream, which is empty if no stream was
+// copied. It does not write a trailer.
+func (j *Joiner) Close() error {
+	if j.tail != nil {
+		return j.writeTail(true)
+	}
+	_, err := j.w.Write(emptyFinal)
+	return err
+}
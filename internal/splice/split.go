@@ -0,0 +1,252 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package splice
+
+import (
+	"bytes"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// A Checksum is the checksum of the uncompressed data that a container
+// format stores in its trailer.
+type Checksum struct {
+	New func() hash.Hash32
+
+	// Combine returns the checksum of two adjacent pieces of data,
+	// given their checksums and the length of the second piece.
+	Combine func(sum1, sum2 uint32, len2 int64) uint32
+}
+
+// A Splitter cuts DEFLATE streams into independent streams at their
+// full-flush points, without recompressing them. A full-flush point is a
+// block boundary on a byte boundary, such as those written by a Joiner,
+// across which the data does not refer back.
+//
+// As it must decode up to 32KB past a full-flush point to tell whether
+// the data refers back across it, a Splitter keeps the compressed data of
+// that range in memory.
+type Splitter struct {
+	minSize int64
+	cs      Checksum
+	next    func() (io.Writer, error)
+	trailer func(w io.Writer, sum uint32, size int64) error
+
+	dec   io.ReadCloser
+	check io.ReadCloser
+	h     hash.Hash32
+	empty uint32 // Checksum of no data
+	tee   teeReader
+	buf   []byte
+
+	base int64      // Offset of tee.buf in the compressed stream
+	cuts []cutPoint // Candidate points, not decided yet
+
+	// The stream being written.
+	w    io.Writer
+	sum  uint32
+	size int64
+}
+
+// A cutPoint is a candidate full-flush point.
+type cutPoint struct {
+	in, out int64  // Offsets in the compressed and uncompressed stream
+	sum     uint32 // Checksum of the data since the previous point
+	size    int64  // Size of the data since the previous point
+}
+
+// NewSplitter returns a Splitter that only cuts a stream once it holds
+// at least minSize bytes of uncompressed data. For every new stream it
+// calls next, which returns the io.Writer to write it to after writing
+// its header, and it ends the stream by calling trailer with the checksum
+// and size of its data. Cut streams end with an empty final block.
+func NewSplitter(minSize int64, sum Checksum, next func() (io.Writer, error), trailer func(w io.Writer, sum uint32, size int64) error) *Splitter {
+	h := sum.New()
+	return &Splitter{
+		minSize: minSize,
+		cs:      sum,
+		next:    next,
+		trailer: trailer,
+		h:       h,
+		empty:   h.Sum32(),
+		buf:     make([]byte, 32<<10),
+	}
+}
+
+// Stream splits the DEFLATE stream read from r, and returns the checksum
+// and size of its uncompressed data, for the caller to verify. The
+// stream is left positioned after its end.
+func (s *Splitter) Stream(r flate.Reader) (uint32, int64, error) {
+	if err := s.start(); err != nil {
+		return 0, 0, err
+	}
+	s.tee = teeReader{r: r, buf: s.tee.buf[:0]}
+	s.base = 0
+	s.cuts = s.cuts[:0]
+	if s.dec == nil {
+		s.dec = flate.NewReader(&s.tee)
+	} else {
+		s.dec.(flate.Resetter).Reset(&s.tee, nil)
+	}
+	var blocks []flate.Block
+	s.dec.(flate.BlockReporter).ReportBlocks(func(b flate.Block) {
+		blocks = append(blocks, b)
+	})
+
+	// Blocks are handled once their data has been read, so that the
+	// checksum of the data preceding them is known.
+	var out, size, streamSize int64
+	streamSum := s.empty
+	s.h.Reset()
+	for {
+		m, err := s.dec.Read(s.buf)
+		p := s.buf[:m]
+		for {
+			if len(blocks) > 0 && blocks[0].Out == out {
+				b := blocks[0]
+				blocks = blocks[1:]
+				if b.Final || b.End%8 == 0 {
+					sum := s.h.Sum32()
+					s.h.Reset()
+					streamSum = s.cs.Combine(streamSum, sum, size)
+					streamSize += size
+					s.cuts = append(s.cuts, cutPoint{in: (b.End + 7) / 8, out: b.Out, sum: sum, size: size})
+					size = 0
+				}
+				if err := s.block(b); err != nil {
+					return 0, 0, err
+				}
+				continue
+			}
+			if len(p) == 0 {
+				break
+			}
+			n := len(p)
+			if len(blocks) > 0 && blocks[0].Out-out < int64(n) {
+				n = int(blocks[0].Out - out)
+			}
+			s.h.Write(p[:n])
+			size += int64(n)
+			out += int64(n)
+			p = p[n:]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return streamSum, streamSize, nil
+}
+
+// block decides on the candidate points that can be decided once the
+// data up to the end of b has been decoded.
+func (s *Splitter) block(b flate.Block) error {
+	for len(s.cuts) > 0 {
+		c := s.cuts[0]
+		if b.Final && c.in == (b.End+7)/8 {
+			// The end of the stream.
+			s.add(c)
+			if err := s.flush(c.in); err != nil {
+				return err
+			}
+			s.cuts = s.cuts[1:]
+			return s.finish(true)
+		}
+		cut := s.size+c.size > 0 && s.size+c.size >= s.minSize
+		if cut && !b.Final && b.Out < c.out+windowSize {
+			// A match may still refer back across c.
+			break
+		}
+		if cut && b.Final && b.Out == c.out {
+			// Nothing would be left for the next stream.
+			cut = false
+		}
+		if cut {
+			cut = s.independent(c, b)
+		}
+		s.add(c)
+		if err := s.flush(c.in); err != nil {
+			return err
+		}
+		s.cuts = s.cuts[1:]
+		if cut {
+			if err := s.finish(false); err != nil {
+				return err
+			}
+			if err := s.start(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.cuts) == 0 {
+		// No decision pending: write out what precedes b.
+		return s.flush(b.End / 8)
+	}
+	return nil
+}
+
+// independent reports whether the data following c up to the end of b
+// decodes without the data preceding c.
+func (s *Splitter) independent(c cutPoint, b flate.Block) bool {
+	in := s.tee.buf[c.in-s.base : (b.End+7)/8-s.base]
+	if s.check == nil {
+		s.check = flate.NewReader(bytes.NewReader(in))
+	} else {
+		s.check.(flate.Resetter).Reset(bytes.NewReader(in), nil)
+	}
+	reached := false
+	s.check.(flate.BlockReporter).ReportBlocks(func(cb flate.Block) {
+		if cb.End == b.End-c.in*8 {
+			reached = true
+		}
+	})
+	io.Copy(ioutil.Discard, s.check)
+	return reached
+}
+
+// add adds the data preceding c to the stream being written.
+func (s *Splitter) add(c cutPoint) {
+	s.sum = s.cs.Combine(s.sum, c.sum, c.size)
+	s.size += c.size
+}
+
+// flush writes the compressed data up to offset in.
+func (s *Splitter) flush(in int64) error {
+	if in <= s.base {
+		return nil
+	}
+	if _, err := s.w.Write(s.tee.buf[:in-s.base]); err != nil {
+		return err
+	}
+	s.tee.drop(int(in - s.base))
+	s.base = in
+	return nil
+}
+
+// start starts a new stream.
+func (s *Splitter) start() error {
+	w, err := s.next()
+	if err != nil {
+		return err
+	}
+	s.w, s.sum, s.size = w, s.empty, 0
+	return nil
+}
+
+// finish ends the stream being written. Unless final is set, the
+// DEFLATE stream is ended with an empty final block.
+func (s *Splitter) finish(final bool) error {
+	if !final {
+		if _, err := s.w.Write(emptyFinal); err != nil {
+			return err
+		}
+	}
+	return s.trailer(s.w, s.sum, s.size)
+}
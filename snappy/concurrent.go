@@ -0,0 +1,584 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"sync"
+)
+
+// chunksPerJob is the number of chunks encoded or decoded by each
+// goroutine of a concurrent Writer or Reader.
+const chunksPerJob = 16
+
+var errReaderClosed = errors.New("snappy: Reader is closed")
+
+// NewConcurrentWriter returns a new Writer that compresses to w like one
+// returned by NewBufferedWriter, but encodes on up to concurrency
+// goroutines at a time while the caller keeps writing. Chunks are written
+// in order, so the output is the same as with a single goroutine.
+//
+// Chunks hold blockSize bytes of uncompressed data. Smaller chunks lower
+// the latency of Flush, at the cost of compression. If blockSize <= 0 or
+// larger than the 64KB allowed by the framing format, 64KB is used.
+// If concurrency <= 0, the number of CPUs is used.
+//
+// Users must call Close to guarantee all data has been forwarded to the
+// underlying io.Writer, and to stop the goroutines.
+func NewConcurrentWriter(w io.Writer, blockSize, concurrency int) *Writer {
+	if blockSize <= 0 || blockSize > maxBlockSize {
+		blockSize = maxBlockSize
+	}
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	return &Writer{
+		w:           w,
+		blockSize:   blockSize,
+		concurrency: concurrency,
+	}
+}
+
+// encJob is a batch of chunks encoded by one goroutine.
+type encJob struct {
+	in     []byte
+	out    []byte
+	header bool          // out starts with the stream identifier
+	starts []int         // offsets of the data chunks in out
+	done   chan struct{} // closed when out is ready
+
+	// flushed is set for flush markers, which have no input. It is
+	// closed when all jobs before the marker have been written.
+	flushed chan struct{}
+}
+
+func (w *Writer) writeConcurrent(p []byte) (nRet int, errRet error) {
+	if err := w.checkErr(); err != nil {
+		return 0, err
+	}
+	for len(p) > 0 {
+		if w.ibuf == nil {
+			w.ibuf = w.getBuf(&w.inBufs, w.blockSize*chunksPerJob)
+		}
+		n := copy(w.ibuf[len(w.ibuf):cap(w.ibuf)], p)
+		w.ibuf = w.ibuf[:len(w.ibuf)+n]
+		nRet += n
+		p = p[n:]
+		if len(w.ibuf) == cap(w.ibuf) {
+			if err := w.dispatch(); err != nil {
+				return nRet, err
+			}
+		}
+	}
+	return nRet, nil
+}
+
+func (w *Writer) getBuf(pool *sync.Pool, size int) []byte {
+	if b, ok := pool.Get().([]byte); ok && cap(b) >= size {
+		return b[:0]
+	}
+	return make([]byte, 0, size)
+}
+
+// dispatch starts encoding the buffered input.
+func (w *Writer) dispatch() error {
+	if len(w.ibuf) == 0 {
+		return nil
+	}
+	w.startOutput()
+	j := &encJob{
+		in:     w.ibuf,
+		header: !w.wroteStreamHeader,
+		done:   make(chan struct{}),
+	}
+	w.wroteStreamHeader = true
+	w.ibuf = nil
+	level := w.level
+	go func() {
+		nChunks := (len(j.in) + w.blockSize - 1) / w.blockSize
+		out := w.getBuf(&w.outBufs, len(magicChunk)+nChunks*(chunkHeaderSize+checksumSize+MaxEncodedLen(w.blockSize)))
+		if j.header {
+			out = append(out, magicChunk...)
+		}
+		j.out, j.starts = appendChunks(out, j.in, w.blockSize, level, j.starts)
+		close(j.done)
+	}()
+	// This blocks while concurrency jobs are waiting to be written.
+	w.output <- j
+	return w.checkErr()
+}
+
+// startOutput starts the output goroutine, if needed.
+func (w *Writer) startOutput() {
+	if w.output == nil {
+		w.output = make(chan *encJob, w.concurrency)
+		w.outputDone = make(chan struct{})
+		go w.writeOutput()
+	}
+}
+
+// writeOutput writes the encoded jobs in order. Jobs without input
+// hold chunks written by writeChunk.
+func (w *Writer) writeOutput() {
+	defer close(w.outputDone)
+	for j := range w.output {
+		if j.flushed != nil {
+			close(j.flushed)
+			continue
+		}
+		<-j.done
+		w.mu.Lock()
+		failed := w.werr != nil
+		w.mu.Unlock()
+		if !failed {
+			for i, start := range j.starts {
+				w.addIndex(w.uncompressed+int64(i*w.blockSize), w.written+int64(start))
+			}
+			w.uncompressed += int64(len(j.in))
+			n, err := w.w.Write(j.out)
+			w.written += int64(n)
+			if err != nil {
+				w.mu.Lock()
+				w.werr = err
+				w.mu.Unlock()
+			}
+		}
+		if j.in != nil {
+			w.inBufs.Put(j.in[:0])
+			w.outBufs.Put(j.out[:0])
+		}
+	}
+}
+
+// checkErr returns the error of the Writer, including write errors
+// of the output goroutine.
+func (w *Writer) checkErr() error {
+	if w.err == nil && w.output != nil {
+		w.mu.Lock()
+		w.err = w.werr
+		w.mu.Unlock()
+	}
+	return w.err
+}
+
+// flushConcurrent encodes the buffered input, and waits until all
+// output has been written.
+func (w *Writer) flushConcurrent() error {
+	if err := w.checkErr(); err != nil {
+		return err
+	}
+	if err := w.dispatch(); err != nil {
+		return err
+	}
+	if w.output == nil {
+		return nil
+	}
+	marker := &encJob{flushed: make(chan struct{})}
+	w.output <- marker
+	<-marker.flushed
+	return w.checkErr()
+}
+
+// stopOutput waits for the output goroutine to write all jobs and exit.
+func (w *Writer) stopOutput() {
+	if w.output != nil {
+		close(w.output)
+		<-w.outputDone
+		w.checkErr()
+		w.output = nil
+	}
+}
+
+// appendChunks appends p to dst as framed chunks of at most blockSize
+// uncompressed bytes each, encoded at level, and the offsets of the chunks
+// to starts.
+func appendChunks(dst, p []byte, blockSize int, level Level, starts []int) ([]byte, []int) {
+	for len(p) > 0 {
+		var uncompressed []byte
+		if len(p) > blockSize {
+			uncompressed, p = p[:blockSize], p[blockSize:]
+		} else {
+			uncompressed, p = p, nil
+		}
+		checksum := crc(uncompressed)
+
+		start := len(dst)
+		starts = append(starts, start)
+		dst = dst[:start+chunkHeaderSize+checksumSize]
+		need := len(dst) + MaxEncodedLen(len(uncompressed))
+		if need > cap(dst) {
+			dst = append(dst[:cap(dst)], make([]byte, need-cap(dst))...)[:len(dst)]
+		}
+		// Compress the buffer, discarding the result if the improvement
+		// isn't at least 12.5%.
+		compressed := level.encode(dst[len(dst):need], uncompressed)
+		chunkType := uint8(chunkTypeCompressedData)
+		if len(compressed) >= len(uncompressed)-len(uncompressed)/8 {
+			chunkType = chunkTypeUncompressedData
+			dst = append(dst, uncompressed...)
+		} else {
+			dst = dst[:len(dst)+len(compressed)]
+		}
+		chunkLen := len(dst) - start - chunkHeaderSize
+		dst[start+0] = chunkType
+		dst[start+1] = uint8(chunkLen >> 0)
+		dst[start+2] = uint8(chunkLen >> 8)
+		dst[start+3] = uint8(chunkLen >> 16)
+		dst[start+4] = uint8(checksum >> 0)
+		dst[start+5] = uint8(checksum >> 8)
+		dst[start+6] = uint8(checksum >> 16)
+		dst[start+7] = uint8(checksum >> 24)
+	}
+	return dst, starts
+}
+
+// NewConcurrentReader returns a new Reader that decompresses from r like
+// one returned by NewReader, but reads ahead and decodes on up to
+// concurrency goroutines at a time. If concurrency <= 0, the number of
+// CPUs is used.
+//
+// The goroutines start at the first Read. Users should call Close when
+// done with the Reader before reaching the end of the stream or an error,
+// to stop them.
+func NewConcurrentReader(r io.Reader, concurrency int) *Reader {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	return &Reader{
+		r:           r,
+		concurrency: concurrency,
+	}
+}
+
+// DecodeConcurrent decompresses the framed stream read from r and writes
+// it to w, decoding on up to concurrency goroutines at a time. If
+// concurrency <= 0, the number of CPUs is used. It returns the number of
+// decompressed bytes written.
+func DecodeConcurrent(w io.Writer, r io.Reader, concurrency int) (int64, error) {
+	zr := NewConcurrentReader(r, concurrency)
+	defer zr.Close()
+	return zr.WriteTo(w)
+}
+
+// rawChunk is a data chunk read by a readAhead, not yet decoded.
+type rawChunk struct {
+	chunkType byte
+	body      []byte // checksum and data
+}
+
+// decJob is a batch of chunks decoded by one goroutine.
+// A job with a chunkType holds a skippable chunk in in.
+type decJob struct {
+	in        []byte
+	chunks    []rawChunk
+	out       []byte
+	err       error
+	ready     chan struct{}
+	chunkType byte
+}
+
+// readAhead reads and decodes the chunks of a concurrent Reader.
+type readAhead struct {
+	r         io.Reader
+	skippable bool  // pass skippable chunks on
+	limit     int64 // see Reader.SetLimit
+	total     int64
+	jobs      chan *decJob
+	done      chan struct{}
+	stop      sync.Once
+	inBufs    sync.Pool
+
+	cur  *decJob
+	data []byte // decoded data of cur not yet returned
+}
+
+func (r *Reader) readConcurrent(p []byte) (int, error) {
+	data := r.nextConcurrent()
+	if len(data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, data)
+	r.ahead.data = data[n:]
+	return n, nil
+}
+
+// nextConcurrent returns the decoded data not yet consumed, waiting for
+// the next job if there is none. The caller advances r.ahead.data. It
+// returns nil and sets r.err when the stream ends or fails.
+func (r *Reader) nextConcurrent() []byte {
+	if r.ahead == nil {
+		r.ahead = &readAhead{
+			r:         r.r,
+			skippable: r.skippableFunc != nil,
+			limit:     r.limit,
+			jobs:      make(chan *decJob, r.concurrency),
+			done:      make(chan struct{}),
+		}
+		go r.ahead.produce()
+	}
+	a := r.ahead
+	for len(a.data) == 0 {
+		if a.cur != nil {
+			a.inBufs.Put(a.cur.in[:0])
+			a.cur = nil
+		}
+		j, ok := <-a.jobs
+		if !ok {
+			r.err = io.EOF
+			return nil
+		}
+		<-j.ready
+		if j.err != nil {
+			r.err = j.err
+			return nil
+		}
+		if j.chunkType != 0 {
+			if err := r.skippableFunc(j.chunkType, j.in); err != nil {
+				r.err = err
+				return nil
+			}
+			continue
+		}
+		a.cur, a.data = j, j.out
+	}
+	return a.data
+}
+
+func (a *readAhead) close() {
+	a.stop.Do(func() { close(a.done) })
+}
+
+func (a *readAhead) send(j *decJob) bool {
+	select {
+	case a.jobs <- j:
+		return true
+	case <-a.done:
+		return false
+	}
+}
+
+// fail sends a job reporting err.
+func (a *readAhead) fail(err error) {
+	j := &decJob{err: err, ready: make(chan struct{})}
+	close(j.ready)
+	a.send(j)
+}
+
+// readFull reads len(p) bytes, converting a truncated chunk to ErrCorrupt.
+func (a *readAhead) readFull(p []byte, allowEOF bool) error {
+	if _, err := io.ReadFull(a.r, p); err != nil {
+		if err == io.ErrUnexpectedEOF || (err == io.EOF && !allowEOF) {
+			err = ErrCorrupt
+		}
+		return err
+	}
+	return nil
+}
+
+// produce reads chunks in batches and starts decoding them.
+func (a *readAhead) produce() {
+	defer close(a.jobs)
+	var hdr [chunkHeaderSize]byte
+	readHeader := false
+	var j *decJob
+	for {
+		err := a.readFull(hdr[:], true)
+		if err == io.EOF {
+			if j != nil {
+				a.start(j)
+			}
+			return
+		}
+		if err != nil {
+			a.fail(err)
+			return
+		}
+		chunkType := hdr[0]
+		if !readHeader {
+			if chunkType != chunkTypeStreamIdentifier {
+				a.fail(ErrCorrupt)
+				return
+			}
+			readHeader = true
+		}
+		chunkLen := int(hdr[1]) | int(hdr[2])<<8 | int(hdr[3])<<16
+		if chunkLen > maxEncodedLenOfMaxBlockSize+checksumSize && chunkType <= 0x7f {
+			a.fail(ErrUnsupported)
+			return
+		}
+
+		switch chunkType {
+		case chunkTypeCompressedData, chunkTypeUncompressedData:
+			if chunkLen < checksumSize {
+				a.fail(ErrCorrupt)
+				return
+			}
+			if j == nil {
+				in, _ := a.inBufs.Get().([]byte)
+				j = &decJob{in: in[:0], ready: make(chan struct{})}
+			}
+			start := len(j.in)
+			j.in = append(j.in, make([]byte, chunkLen)...)
+			if err := a.readFull(j.in[start:], false); err != nil {
+				a.fail(err)
+				return
+			}
+			j.chunks = append(j.chunks, rawChunk{chunkType: chunkType, body: j.in[start:]})
+			if a.limit > 0 {
+				// Fail after the chunks before this one.
+				a.total += int64(decodedChunkLen(chunkType, j.in[start:]))
+				if a.total > a.limit {
+					j.chunks = j.chunks[:len(j.chunks)-1]
+					if len(j.chunks) > 0 && !a.start(j) {
+						return
+					}
+					a.fail(ErrLimit)
+					return
+				}
+			}
+			if len(j.chunks) == chunksPerJob {
+				if !a.start(j) {
+					return
+				}
+				j = nil
+			}
+			continue
+
+		case chunkTypeStreamIdentifier:
+			var body [len(magicBody)]byte
+			if chunkLen != len(magicBody) {
+				a.fail(ErrCorrupt)
+				return
+			}
+			if err := a.readFull(body[:], false); err != nil {
+				a.fail(err)
+				return
+			}
+			if string(body[:]) != magicBody {
+				a.fail(ErrCorrupt)
+				return
+			}
+			continue
+		}
+
+		if chunkType <= 0x7f {
+			// Section 4.5. Reserved unskippable chunks (chunk types 0x02-0x7f).
+			a.fail(ErrUnsupported)
+			return
+		}
+		// Section 4.4 Padding (chunk type 0xfe).
+		// Section 4.6. Reserved skippable chunks (chunk types 0x80-0xfd).
+		if !a.skippable {
+			if _, err := io.CopyN(ioutil.Discard, a.r, int64(chunkLen)); err != nil {
+				a.fail(ErrCorrupt)
+				return
+			}
+			continue
+		}
+		// Keep the chunk in order with the data around it.
+		if j != nil {
+			if !a.start(j) {
+				return
+			}
+			j = nil
+		}
+		sj := &decJob{in: make([]byte, chunkLen), chunkType: chunkType, ready: make(chan struct{})}
+		if err := a.readFull(sj.in, false); err != nil {
+			a.fail(err)
+			return
+		}
+		close(sj.ready)
+		if !a.send(sj) {
+			return
+		}
+	}
+}
+
+// start decodes j on a new goroutine, and queues it for reading.
+func (a *readAhead) start(j *decJob) bool {
+	// The bodies may have moved while j.in grew.
+	off := 0
+	for i := range j.chunks {
+		n := len(j.chunks[i].body)
+		j.chunks[i].body = j.in[off : off+n]
+		off += n
+	}
+	go func() {
+		out := make([]byte, 0, len(j.chunks)*maxBlockSize)
+		for _, c := range j.chunks {
+			if out, j.err = decodeChunk(out, c); j.err != nil {
+				break
+			}
+		}
+		j.out = out
+		close(j.ready)
+	}()
+	return a.send(j)
+}
+
+// decodedChunkLen returns the decoded length a data chunk declares, or 0 if
+// it is corrupt.
+func decodedChunkLen(chunkType byte, body []byte) int {
+	if chunkType == chunkTypeUncompressedData {
+		return len(body) - checksumSize
+	}
+	n, err := DecodedLen(body[checksumSize:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// decodeChunk appends the data of a compressed or uncompressed data chunk
+// to dst, verifying its checksum.
+func decodeChunk(dst []byte, c rawChunk) ([]byte, error) {
+	buf := c.body
+	checksum := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
+	buf = buf[checksumSize:]
+	start := len(dst)
+	if c.chunkType == chunkTypeCompressedData {
+		n, err := DecodedLen(buf)
+		if err != nil {
+			return dst, err
+		}
+		if n > maxBlockSize {
+			return dst, ErrCorrupt
+		}
+		if _, err := Decode(dst[start:start+n], buf); err != nil {
+			return dst, err
+		}
+		dst = dst[:start+n]
+	} else {
+		if len(buf) > maxBlockSize {
+			return dst, ErrCorrupt
+		}
+		dst = append(dst, buf...)
+	}
+	if crc(dst[start:]) != checksum {
+		return dst, ErrCorrupt
+	}
+	return dst, nil
+}
+
+// Close stops the goroutines of a Reader created by NewConcurrentReader.
+// It does not close the underlying io.Reader, and a goroutine blocked
+// reading from it exits once that read returns. For other Readers, Close
+// does nothing.
+func (r *Reader) Close() error {
+	if r.concurrency == 0 {
+		return nil
+	}
+	if r.ahead != nil {
+		r.ahead.close()
+		r.ahead = nil
+	}
+	if r.err == nil || r.err == io.EOF {
+		r.err = errReaderClosed
+	}
+	return nil
+}
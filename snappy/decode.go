@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
 )
 
 var (
@@ -17,6 +18,9 @@ var (
 	ErrTooLarge = errors.New("snappy: decoded block is too large")
 	// ErrUnsupported reports that the input isn't supported.
 	ErrUnsupported = errors.New("snappy: unsupported input")
+	// ErrLimit reports that a stream decodes to more than the limit set
+	// with Reader.SetLimit.
+	ErrLimit = errors.New("snappy: decoded stream exceeds limit")
 
 	errUnsupportedLiteralLength = errors.New("snappy: unsupported literal length")
 )
@@ -53,10 +57,25 @@ const (
 //
 // The dst and src must not overlap. It is valid to pass a nil dst.
 func Decode(dst, src []byte) ([]byte, error) {
+	return DecodeLimit(dst, src, -1)
+}
+
+// DecodeLimit is like Decode, but returns ErrTooLarge without allocating
+// if src declares a decoded length of more than limit bytes. With limit set
+// to len(dst), it never allocates. If limit < 0, there is no limit.
+func DecodeLimit(dst, src []byte, limit int) ([]byte, error) {
 	dLen, s, err := decodedLen(src)
 	if err != nil {
 		return nil, err
 	}
+	if limit >= 0 && dLen > limit {
+		return nil, ErrTooLarge
+	}
+	// Every byte of src decodes to at most 64/3 bytes, as with a 3 byte
+	// copy of 64 bytes, so larger lengths cannot be valid.
+	if uint64(dLen) > uint64(len(src)-s)*64/3 {
+		return nil, ErrCorrupt
+	}
 	if dLen <= len(dst) {
 		dst = dst[:dLen]
 	} else {
@@ -71,6 +90,98 @@ func Decode(dst, src []byte) ([]byte, error) {
 	return nil, ErrCorrupt
 }
 
+// decodeAt is like decode, but starts writing at dst[d:], and lets copies
+// refer back into dst[:d], which holds the dictionary for DecodeDict. It is
+// the implementation of decode on platforms without an assembly version.
+func decodeAt(dst []byte, d int, src []byte) int {
+	var s, offset, length int
+	for s < len(src) {
+		switch src[s] & 0x03 {
+		case tagLiteral:
+			x := uint32(src[s] >> 2)
+			switch {
+			case x < 60:
+				s++
+			case x == 60:
+				s += 2
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-1])
+			case x == 61:
+				s += 3
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-2]) | uint32(src[s-1])<<8
+			case x == 62:
+				s += 4
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-3]) | uint32(src[s-2])<<8 | uint32(src[s-1])<<16
+			case x == 63:
+				s += 5
+				if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+					return decodeErrCodeCorrupt
+				}
+				x = uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24
+			}
+			length = int(x) + 1
+			if length <= 0 {
+				return decodeErrCodeUnsupportedLiteralLength
+			}
+			if length > len(dst)-d || length > len(src)-s {
+				return decodeErrCodeCorrupt
+			}
+			copy(dst[d:], src[s:s+length])
+			d += length
+			s += length
+			continue
+
+		case tagCopy1:
+			s += 2
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = 4 + int(src[s-2])>>2&0x7
+			offset = int(uint32(src[s-2])&0xe0<<3 | uint32(src[s-1]))
+
+		case tagCopy2:
+			s += 3
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = 1 + int(src[s-3])>>2
+			offset = int(uint32(src[s-2]) | uint32(src[s-1])<<8)
+
+		case tagCopy4:
+			s += 5
+			if uint(s) > uint(len(src)) { // The uint conversions catch overflow from the previous line.
+				return decodeErrCodeCorrupt
+			}
+			length = 1 + int(src[s-5])>>2
+			offset = int(uint32(src[s-4]) | uint32(src[s-3])<<8 | uint32(src[s-2])<<16 | uint32(src[s-1])<<24)
+		}
+
+		if offset <= 0 || d < offset || length > len(dst)-d {
+			return decodeErrCodeCorrupt
+		}
+		// Copy from an earlier sub-slice of dst to a later sub-slice. Unlike
+		// the built-in copy function, this byte-by-byte copy always runs
+		// forwards, even if the slices overlap. Conceptually, this is:
+		//
+		// d += forwardCopy(dst[d:d+length], dst[d-offset:])
+		for end := d + length; d != end; d++ {
+			dst[d] = dst[d-offset]
+		}
+	}
+	if d != len(dst) {
+		return decodeErrCodeCorrupt
+	}
+	return 0
+}
+
 // NewReader returns a new Reader that decompresses from r, using the framing
 // format described at
 // https://github.com/google/snappy/blob/master/framing_format.txt
@@ -91,17 +202,55 @@ type Reader struct {
 	// decoded[i:j] contains decoded bytes that have not yet been passed on.
 	i, j       int
 	readHeader bool
+
+	skippableFunc func(chunkType byte, data []byte) error
+
+	// total is the number of bytes decoded, and limit the maximum set
+	// with SetLimit, or 0.
+	total int64
+	limit int64
+
+	// Concurrent decoding, see NewConcurrentReader.
+	concurrency int
+	ahead       *readAhead
 }
 
 // Reset discards any buffered data, resets all state, and switches the Snappy
 // reader to read from r. This permits reusing a Reader rather than allocating
 // a new one.
 func (r *Reader) Reset(reader io.Reader) {
+	if r.ahead != nil {
+		r.ahead.close()
+		r.ahead = nil
+	}
 	r.r = reader
 	r.err = nil
 	r.i = 0
 	r.j = 0
 	r.readHeader = false
+	r.total = 0
+}
+
+// SetLimit makes the Reader fail with ErrLimit instead of returning a chunk
+// that takes the decoded size of the stream over n bytes. The limit is
+// checked against the length each chunk declares, before decoding it. If
+// n <= 0, there is no limit. It must be called before the first Read.
+func (r *Reader) SetLimit(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	r.limit = n
+}
+
+// allow adds n to the decoded size, and reports whether it is within the
+// limit.
+func (r *Reader) allow(n int) bool {
+	r.total += int64(n)
+	if r.limit > 0 && r.total > r.limit {
+		r.err = ErrLimit
+		return false
+	}
+	return true
 }
 
 func (r *Reader) readFull(p []byte, allowEOF bool) (ok bool) {
@@ -119,27 +268,70 @@ func (r *Reader) Read(p []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
+	if r.concurrency > 0 {
+		return r.readConcurrent(p)
+	}
 	for {
 		if r.i < r.j {
 			n := copy(p, r.decoded[r.i:r.j])
 			r.i += n
 			return n, nil
 		}
-		if !r.readFull(r.buf[:4], true) {
+		if !r.nextChunk() {
 			return 0, r.err
 		}
+	}
+}
+
+// WriteTo implements the io.WriterTo interface, writing the decoded
+// chunks to w without copying them.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for r.err == nil {
+		var data []byte
+		if r.concurrency > 0 {
+			data = r.nextConcurrent()
+			r.ahead.data = nil
+		} else if r.i < r.j || r.nextChunk() {
+			data = r.decoded[r.i:r.j]
+			r.i = r.j
+		}
+		if len(data) > 0 {
+			n, err := w.Write(data)
+			total += int64(n)
+			if err == nil && n < len(data) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	if r.err == io.EOF {
+		return total, nil
+	}
+	return total, r.err
+}
+
+// nextChunk decodes the next data chunk into r.decoded[r.i:r.j].
+// It returns false and sets r.err if there is none.
+func (r *Reader) nextChunk() bool {
+	for {
+		if !r.readFull(r.buf[:4], true) {
+			return false
+		}
 		chunkType := r.buf[0]
 		if !r.readHeader {
 			if chunkType != chunkTypeStreamIdentifier {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			r.readHeader = true
 		}
 		chunkLen := int(r.buf[1]) | int(r.buf[2])<<8 | int(r.buf[3])<<16
-		if chunkLen > len(r.buf) {
+		if chunkLen > len(r.buf) && chunkType <= 0x7f {
 			r.err = ErrUnsupported
-			return 0, r.err
+			return false
 		}
 
 		// The chunk types are specified at
@@ -149,11 +341,11 @@ func (r *Reader) Read(p []byte) (int, error) {
 			// Section 4.2. Compressed data (chunk type 0x00).
 			if chunkLen < checksumSize {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			buf := r.buf[:chunkLen]
 			if !r.readFull(buf, false) {
-				return 0, r.err
+				return false
 			}
 			checksum := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
 			buf = buf[checksumSize:]
@@ -161,63 +353,69 @@ func (r *Reader) Read(p []byte) (int, error) {
 			n, err := DecodedLen(buf)
 			if err != nil {
 				r.err = err
-				return 0, r.err
+				return false
 			}
 			if n > len(r.decoded) {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
+			}
+			if !r.allow(n) {
+				return false
 			}
 			if _, err := Decode(r.decoded, buf); err != nil {
 				r.err = err
-				return 0, r.err
+				return false
 			}
 			if crc(r.decoded[:n]) != checksum {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			r.i, r.j = 0, n
-			continue
+			return true
 
 		case chunkTypeUncompressedData:
 			// Section 4.3. Uncompressed data (chunk type 0x01).
 			if chunkLen < checksumSize {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			buf := r.buf[:checksumSize]
 			if !r.readFull(buf, false) {
-				return 0, r.err
+				return false
 			}
 			checksum := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16 | uint32(buf[3])<<24
 			// Read directly into r.decoded instead of via r.buf.
 			n := chunkLen - checksumSize
 			if n > len(r.decoded) {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
+			}
+			if !r.allow(n) {
+				return false
 			}
 			if !r.readFull(r.decoded[:n], false) {
-				return 0, r.err
+				return false
 			}
 			if crc(r.decoded[:n]) != checksum {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			r.i, r.j = 0, n
-			continue
+			return true
 
 		case chunkTypeStreamIdentifier:
 			// Section 4.1. Stream identifier (chunk type 0xff).
 			if chunkLen != len(magicBody) {
 				r.err = ErrCorrupt
-				return 0, r.err
+				return false
 			}
 			if !r.readFull(r.buf[:len(magicBody)], false) {
-				return 0, r.err
+				return false
 			}
 			for i := 0; i < len(magicBody); i++ {
 				if r.buf[i] != magicBody[i] {
 					r.err = ErrCorrupt
-					return 0, r.err
+					return false
 				}
 			}
 			continue
@@ -226,12 +424,29 @@ func (r *Reader) Read(p []byte) (int, error) {
 		if chunkType <= 0x7f {
 			// Section 4.5. Reserved unskippable chunks (chunk types 0x02-0x7f).
 			r.err = ErrUnsupported
-			return 0, r.err
+			return false
 		}
 		// Section 4.4 Padding (chunk type 0xfe).
 		// Section 4.6. Reserved skippable chunks (chunk types 0x80-0xfd).
-		if !r.readFull(r.buf[:chunkLen], false) {
-			return 0, r.err
+		if r.skippableFunc == nil && chunkLen > len(r.buf) {
+			if _, err := io.CopyN(ioutil.Discard, r.r, int64(chunkLen)); err != nil {
+				r.err = ErrCorrupt
+				return false
+			}
+			continue
+		}
+		buf := r.buf
+		if chunkLen > len(buf) {
+			buf = make([]byte, chunkLen)
+		}
+		if !r.readFull(buf[:chunkLen], false) {
+			return false
+		}
+		if r.skippableFunc != nil {
+			if err := r.skippableFunc(chunkType, buf[:chunkLen]); err != nil {
+				r.err = err
+				return false
+			}
 		}
 	}
 }
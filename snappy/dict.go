@@ -0,0 +1,201 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// MaxDictSize is the maximum length of a dictionary. Copies can
+	// reach back 65535 bytes at most.
+	MaxDictSize = 65535
+
+	dictTableBits = 14
+)
+
+var (
+	errDictTooLarge = errors.New("snappy: dictionary is too large")
+	errNilDict      = errors.New("snappy: nil dictionary")
+)
+
+// Dict is a dictionary shared by an encoder and a decoder, for blocks that
+// are too short to compress well on their own. The blocks encoded with it
+// use the snappy block format, but their copies may refer to the dictionary
+// as if it came right before the block: they can only be decoded by
+// DecodeDict with the same dictionary.
+//
+// A Dict is safe for concurrent use.
+type Dict struct {
+	b []byte
+	// table holds 1 + the last position of each hash in b, or 0.
+	table [1 << dictTableBits]uint16
+}
+
+// NewDict returns a Dict holding a copy of b, which should hold content
+// typical of the blocks to encode, with the most common content at the end.
+// It returns an error if b is longer than MaxDictSize.
+func NewDict(b []byte) (*Dict, error) {
+	if len(b) > MaxDictSize {
+		return nil, errDictTooLarge
+	}
+	d := &Dict{b: append([]byte(nil), b...)}
+	for i := 0; i+4 <= len(b); i++ {
+		d.table[hash4(uint64(le32(b, i)), dictTableBits)] = uint16(i + 1)
+	}
+	return d, nil
+}
+
+// Bytes returns the dictionary content. It must not be modified.
+func (d *Dict) Bytes() []byte {
+	return d.b
+}
+
+// EncodeDict returns the encoded form of src, like Encode, with copies from
+// dict allowed in its first 64KB. The returned slice may be a sub-slice of
+// dst if dst was large enough to hold the entire encoded block. Otherwise,
+// a newly allocated slice will be returned.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst, but not
+// a nil dict.
+func EncodeDict(dst, src []byte, dict *Dict) []byte {
+	if n := MaxEncodedLen(len(src)); n < 0 {
+		panic(ErrTooLarge)
+	} else if len(dst) < n {
+		dst = make([]byte, n)
+	}
+
+	// The block starts with the varint-encoded length of the decompressed bytes.
+	d := binary.PutUvarint(dst, uint64(len(src)))
+
+	for first := true; len(src) > 0; first = false {
+		p := src
+		src = nil
+		if len(p) > maxBlockSize {
+			p, src = p[:maxBlockSize], p[maxBlockSize:]
+		}
+		switch {
+		case first:
+			d += encodeBlockDict(dst[d:], p, dict)
+		case len(p) < minNonLiteralBlockSize:
+			d += emitLiteral(dst[d:], p)
+		default:
+			d += encodeBlock(dst[d:], p)
+		}
+	}
+	return dst[:d]
+}
+
+// DecodeDict returns the decoded form of src, which was encoded by
+// EncodeDict or Encode. The returned slice may be a sub-slice of dst if
+// dst was large enough to hold dict and the entire decoded block.
+// Otherwise, a newly allocated slice will be returned.
+//
+// The dst and src must not overlap. It is valid to pass a nil dst. A nil
+// dict is an error.
+func DecodeDict(dst, src []byte, dict *Dict) ([]byte, error) {
+	if dict == nil {
+		return nil, errNilDict
+	}
+	dLen, s, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(dLen) > uint64(len(src)-s)*64/3 {
+		return nil, ErrCorrupt
+	}
+	n := len(dict.b) + dLen
+	if n <= cap(dst) {
+		dst = dst[:n]
+	} else {
+		dst = make([]byte, n)
+	}
+	copy(dst, dict.b)
+	switch decodeAt(dst, len(dict.b), src[s:]) {
+	case 0:
+		return dst[len(dict.b):], nil
+	case decodeErrCodeUnsupportedLiteralLength:
+		return nil, errUnsupportedLiteralLength
+	}
+	return nil, ErrCorrupt
+}
+
+// encodeBlockDict encodes a src of at most maxBlockSize bytes to a
+// guaranteed-large-enough dst, looking for matches in src and dict.
+func encodeBlockDict(dst, src []byte, dict *Dict) (d int) {
+	if len(src) < 4 {
+		return emitLiteral(dst, src)
+	}
+	// Size the table for src as encodeBlock does. It holds 1 + the last
+	// position of each hash, or 0.
+	const maxTableBits = 14
+	tableBits := uint(8)
+	for tableBits < maxTableBits && 1<<tableBits < len(src) {
+		tableBits++
+	}
+	var table [1 << maxTableBits]uint16
+
+	// Positions in dict are before src: position i of src is at
+	// len(dict.b)+i.
+	db := dict.b
+	sLimit := len(src) - 4
+	nextEmit := 0
+	s := 0
+	for {
+		var offset, candidate int
+		skip := 32
+		for {
+			if s > sLimit {
+				goto emitRemainder
+			}
+			u := le32(src, s)
+			h := hash4(uint64(u), tableBits)
+			candidate = int(table[h]) - 1
+			table[h] = uint16(s + 1)
+			if candidate >= 0 && le32(src, candidate) == u {
+				offset = s - candidate
+				candidate += len(db)
+				break
+			}
+			candidate = int(dict.table[hash4(uint64(u), dictTableBits)]) - 1
+			if candidate >= 0 && len(db)-candidate+s <= maxCopyOffset && le32(db, candidate) == u {
+				offset = len(db) - candidate + s
+				break
+			}
+			s += skip >> 5
+			skip++
+		}
+
+		// Extend the match, which may run from dict into src.
+		base := s
+		s += 4
+		for i := candidate + 4; s < len(src); i, s = i+1, s+1 {
+			var c byte
+			if i < len(db) {
+				c = db[i]
+			} else {
+				c = src[i-len(db)]
+			}
+			if c != src[s] {
+				break
+			}
+		}
+		if nextEmit < base {
+			d += emitLiteral(dst[d:], src[nextEmit:base])
+		}
+		d += emitCopy(dst[d:], offset, s-base)
+		nextEmit = s
+		if s <= sLimit {
+			table[hash4(uint64(le32(src, s-1)), tableBits)] = uint16(s)
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		d += emitLiteral(dst[d:], src[nextEmit:])
+	}
+	return d
+}
@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"sync"
 )
 
 // Encode returns the encoded form of src. The returned slice may be a sub-
@@ -16,6 +17,12 @@ import (
 //
 // The dst and src must not overlap. It is valid to pass a nil dst.
 func Encode(dst, src []byte) []byte {
+	return encodeWith(dst, src, encodeBlock)
+}
+
+// encodeWith encodes src like Encode, using encodeBlock to encode each
+// block of at least minNonLiteralBlockSize bytes.
+func encodeWith(dst, src []byte, encodeBlock func(dst, src []byte) int) []byte {
 	if n := MaxEncodedLen(len(src)); n < 0 {
 		panic(ErrTooLarge)
 	} else if len(dst) < n {
@@ -155,13 +162,38 @@ type Writer struct {
 
 	// wroteStreamHeader is whether we have written the stream header.
 	wroteStreamHeader bool
+
+	// level selects the block encoder, see SetLevel.
+	level Level
+
+	// written is the number of bytes written to w, and uncompressed the
+	// number of bytes of data in them. index holds chunk positions.
+	written      int64
+	uncompressed int64
+	index        []indexEntry
+
+	// Concurrent encoding, see NewConcurrentWriter. If concurrency is
+	// set, ibuf is a batch of chunks, and nil until data is written.
+	blockSize   int
+	concurrency int
+	output      chan *encJob // jobs, in order, for the output goroutine
+	outputDone  chan struct{}
+	inBufs      sync.Pool
+	outBufs     sync.Pool
+	mu          sync.Mutex
+	werr        error // error of the output goroutine, guarded by mu
 }
 
 // Reset discards the writer's state and switches the Snappy writer to write to
 // w. This permits reusing a Writer rather than allocating a new one.
 func (w *Writer) Reset(writer io.Writer) {
+	w.stopOutput()
 	w.w = writer
 	w.err = nil
+	w.werr = nil
+	w.written = 0
+	w.uncompressed = 0
+	w.index = w.index[:0]
 	if w.ibuf != nil {
 		w.ibuf = w.ibuf[:0]
 	}
@@ -170,6 +202,9 @@ func (w *Writer) Reset(writer io.Writer) {
 
 // Write satisfies the io.Writer interface.
 func (w *Writer) Write(p []byte) (nRet int, errRet error) {
+	if w.concurrency > 0 {
+		return w.writeConcurrent(p)
+	}
 	if w.ibuf == nil {
 		// Do not buffer incoming bytes. This does not perform or compress well
 		// if the caller of Writer.Write writes many small slices. This
@@ -204,6 +239,58 @@ func (w *Writer) Write(p []byte) (nRet int, errRet error) {
 	return nRet, nil
 }
 
+// ReadFrom implements the io.ReaderFrom interface, reading from r directly
+// into the Writer's buffers until r returns io.EOF.
+func (w *Writer) ReadFrom(r io.Reader) (n int64, err error) {
+	if w.concurrency == 0 && w.ibuf == nil {
+		// Unbuffered Writer: compress each full block as it is read.
+		buf := make([]byte, maxBlockSize)
+		for {
+			m, rerr := io.ReadFull(r, buf)
+			if m > 0 {
+				if _, err := w.write(buf[:m]); err != nil {
+					return n, err
+				}
+				n += int64(m)
+			}
+			if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+				return n, nil
+			}
+			if rerr != nil {
+				return n, rerr
+			}
+		}
+	}
+	for {
+		if err := w.checkErr(); err != nil {
+			return n, err
+		}
+		if w.concurrency > 0 && w.ibuf == nil {
+			w.ibuf = w.getBuf(&w.inBufs, w.blockSize*chunksPerJob)
+		}
+		if len(w.ibuf) == cap(w.ibuf) {
+			if w.concurrency > 0 {
+				err = w.dispatch()
+			} else {
+				err = w.Flush()
+			}
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		m, rerr := r.Read(w.ibuf[len(w.ibuf):cap(w.ibuf)])
+		w.ibuf = w.ibuf[:len(w.ibuf)+m]
+		n += int64(m)
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
 func (w *Writer) write(p []byte) (nRet int, errRet error) {
 	if w.err != nil {
 		return 0, w.err
@@ -223,10 +310,11 @@ func (w *Writer) write(p []byte) (nRet int, errRet error) {
 			uncompressed, p = p, nil
 		}
 		checksum := crc(uncompressed)
+		w.addIndex(w.uncompressed, w.written+int64(len(magicChunk)-obufStart))
 
 		// Compress the buffer, discarding the result if the improvement
 		// isn't at least 12.5%.
-		compressed := Encode(w.obuf[obufHeaderLen:], uncompressed)
+		compressed := w.level.encode(w.obuf[obufHeaderLen:], uncompressed)
 		chunkType := uint8(chunkTypeCompressedData)
 		chunkLen := 4 + len(compressed)
 		obufEnd := obufHeaderLen + len(compressed)
@@ -246,23 +334,31 @@ func (w *Writer) write(p []byte) (nRet int, errRet error) {
 		w.obuf[len(magicChunk)+6] = uint8(checksum >> 16)
 		w.obuf[len(magicChunk)+7] = uint8(checksum >> 24)
 
-		if _, err := w.w.Write(w.obuf[obufStart:obufEnd]); err != nil {
+		n, err := w.w.Write(w.obuf[obufStart:obufEnd])
+		w.written += int64(n)
+		if err != nil {
 			w.err = err
 			return nRet, err
 		}
 		if chunkType == chunkTypeUncompressedData {
-			if _, err := w.w.Write(uncompressed); err != nil {
+			n, err := w.w.Write(uncompressed)
+			w.written += int64(n)
+			if err != nil {
 				w.err = err
 				return nRet, err
 			}
 		}
 		nRet += len(uncompressed)
+		w.uncompressed += int64(len(uncompressed))
 	}
 	return nRet, nil
 }
 
 // Flush flushes the Writer to its underlying io.Writer.
 func (w *Writer) Flush() error {
+	if w.concurrency > 0 {
+		return w.flushConcurrent()
+	}
 	if w.err != nil {
 		return w.err
 	}
@@ -277,6 +373,7 @@ func (w *Writer) Flush() error {
 // Close calls Flush and then closes the Writer.
 func (w *Writer) Close() error {
 	w.Flush()
+	w.stopOutput()
 	ret := w.err
 	if w.err == nil {
 		w.err = errClosed
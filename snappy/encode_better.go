@@ -0,0 +1,309 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Level selects the block encoder used by a Writer.
+type Level int
+
+const (
+	// LevelFast uses Encode. It is the default.
+	LevelFast Level = iota
+	// LevelBetter uses EncodeBetter.
+	LevelBetter
+	// LevelBest uses EncodeBest.
+	LevelBest
+)
+
+var errLevel = errors.New("snappy: invalid compression level")
+
+// encode encodes src with the encoder selected by l.
+func (l Level) encode(dst, src []byte) []byte {
+	switch l {
+	case LevelBetter:
+		return EncodeBetter(dst, src)
+	case LevelBest:
+		return EncodeBest(dst, src)
+	}
+	return Encode(dst, src)
+}
+
+// SetLevel selects the encoder for the data compressed after the call,
+// including data already buffered but not yet flushed.
+func (w *Writer) SetLevel(level Level) error {
+	if level < LevelFast || level > LevelBest {
+		return errLevel
+	}
+	w.level = level
+	return nil
+}
+
+// EncodeBetter returns the encoded form of src, like Encode, but spends
+// more CPU time looking for matches: it checks the last match offset, keeps
+// separate tables for long and short matches, and tries one byte later
+// before taking a short match.
+//
+// The output is a regular snappy block, which Decode and any other snappy
+// decoder can read. The dst and src must not overlap. It is valid to pass
+// a nil dst.
+func EncodeBetter(dst, src []byte) []byte {
+	return encodeWith(dst, src, encodeBlockBetter)
+}
+
+// EncodeBest returns the encoded form of src, like EncodeBetter, but
+// remembers two candidates for every hash, indexes every position of each
+// match and picks the match that saves the most output bytes. It is
+// considerably slower than EncodeBetter.
+//
+// The output is a regular snappy block, which Decode and any other snappy
+// decoder can read. The dst and src must not overlap. It is valid to pass
+// a nil dst.
+func EncodeBest(dst, src []byte) []byte {
+	return encodeWith(dst, src, encodeBlockBest)
+}
+
+// maxCopyOffset is the largest offset a copy can refer to.
+const maxCopyOffset = 65535
+
+func le32(b []byte, i int) uint32 {
+	return binary.LittleEndian.Uint32(b[i:])
+}
+
+func le64(b []byte, i int) uint64 {
+	return binary.LittleEndian.Uint64(b[i:])
+}
+
+// hash4 returns a hash of the low 4 bytes of u, using bits bits.
+func hash4(u uint64, bits uint) uint32 {
+	return (uint32(u) * 2654435761) >> (32 - bits)
+}
+
+// hash7 returns a hash of the low 7 bytes of u, using bits bits.
+func hash7(u uint64, bits uint) uint32 {
+	return uint32(((u << 8) * 58295818150454627) >> (64 - bits))
+}
+
+// copyCost returns the number of bytes emitCopy uses for a copy.
+func copyCost(offset, length int) int {
+	n := 0
+	for length >= 68 {
+		n += 3
+		length -= 64
+	}
+	if length > 64 {
+		n += 3
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return n + 3
+	}
+	return n + 2
+}
+
+// encodeBlockBetter has the same semantics as encodeBlock.
+func encodeBlockBetter(dst, src []byte) (d int) {
+	const (
+		lTableBits = 16
+		sTableBits = 14
+	)
+	// Positions fit in a uint16, as len(src) <= maxBlockSize.
+	var lTable [1 << lTableBits]uint16
+	var sTable [1 << sTableBits]uint16
+
+	sLimit := len(src) - inputMargin
+	nextEmit := 0
+	repeat := 1
+	s := 1
+	cv := le64(src, s)
+	for {
+		var offset int
+		for {
+			// Skip ahead faster the longer no match is found, but slower
+			// than encodeBlock does.
+			nextS := s + (s-nextEmit)>>7 + 1
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			hashL := hash7(cv, lTableBits)
+			hashS := hash4(cv, sTableBits)
+			candidateL := int(lTable[hashL])
+			candidateS := int(sTable[hashS])
+			lTable[hashL] = uint16(s)
+			sTable[hashS] = uint16(s)
+
+			if uint32(cv>>8) == le32(src, s-repeat+1) {
+				// The last offset matches at s+1.
+				s++
+				offset = repeat
+				break
+			}
+			if uint32(cv) == le32(src, candidateL) {
+				offset = s - candidateL
+				break
+			}
+			if uint32(cv) == le32(src, candidateS) {
+				// Prefer a long match at s+1 over a short one at s.
+				cv1 := le64(src, s+1)
+				hash1 := hash7(cv1, lTableBits)
+				candidate1 := int(lTable[hash1])
+				lTable[hash1] = uint16(s + 1)
+				if uint32(cv1) == le32(src, candidate1) {
+					s++
+					offset = s - candidate1
+				} else {
+					offset = s - candidateS
+				}
+				break
+			}
+			s = nextS
+			cv = le64(src, s)
+		}
+
+		// Extend the match backwards, over bytes not yet emitted, and then
+		// forwards as long as possible.
+		for s > nextEmit && s > offset && src[s-1] == src[s-offset-1] {
+			s--
+		}
+		base := s
+		s += 4
+		for i := base - offset + 4; s < len(src) && src[i] == src[s]; i, s = i+1, s+1 {
+		}
+		if nextEmit < base {
+			d += emitLiteral(dst[d:], src[nextEmit:base])
+		}
+		d += emitCopy(dst[d:], offset, s-base)
+		repeat = offset
+		nextEmit = s
+		if s >= sLimit {
+			goto emitRemainder
+		}
+
+		// Index the start and the end of the match.
+		i0, i1 := base+1, s-2
+		cv0, cv1 := le64(src, i0), le64(src, i1)
+		lTable[hash7(cv0, lTableBits)] = uint16(i0)
+		sTable[hash4(cv0>>8, sTableBits)] = uint16(i0 + 1)
+		lTable[hash7(cv1, lTableBits)] = uint16(i1)
+		sTable[hash4(cv1>>8, sTableBits)] = uint16(i1 + 1)
+		cv = le64(src, s)
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		d += emitLiteral(dst[d:], src[nextEmit:])
+	}
+	return d
+}
+
+// bestMatch is a match found by encodeBlockBest.
+type bestMatch struct {
+	s, offset, length int
+	score             int // bytes saved by emitting the match as a copy
+}
+
+// encodeBlockBest has the same semantics as encodeBlock.
+func encodeBlockBest(dst, src []byte) (d int) {
+	const (
+		lTableBits = 16
+		sTableBits = 14
+	)
+	// Each entry holds the last two positions with the hash, the most
+	// recent one in the low 16 bits.
+	lTable := make([]uint32, 1<<lTableBits)
+	sTable := make([]uint32, 1<<sTableBits)
+
+	sLimit := len(src) - inputMargin
+	nextEmit := 0
+	repeat := 1
+
+	// matchAt returns the match of src[s:] with src[candidate:], if any.
+	matchAt := func(s, candidate int) bestMatch {
+		if candidate < 0 || candidate >= s || s-candidate > maxCopyOffset || le32(src, s) != le32(src, candidate) {
+			return bestMatch{}
+		}
+		end := s + 4
+		for i := candidate + 4; end < len(src) && src[i] == src[end]; i, end = i+1, end+1 {
+		}
+		for s > nextEmit && candidate > 0 && src[s-1] == src[candidate-1] {
+			s, candidate = s-1, candidate-1
+		}
+		m := bestMatch{s: s, offset: s - candidate, length: end - s}
+		m.score = m.length - copyCost(m.offset, m.length)
+		return m
+	}
+	// find indexes s and returns the best of m and the matches at s.
+	find := func(s int, m bestMatch) bestMatch {
+		cv := le64(src, s)
+		hashL := hash7(cv, lTableBits)
+		hashS := hash4(cv, sTableBits)
+		candidateL := lTable[hashL]
+		candidateS := sTable[hashS]
+		lTable[hashL] = uint32(s) | candidateL<<16
+		sTable[hashS] = uint32(s) | candidateS<<16
+		for _, c := range [...]int{
+			s - repeat,
+			int(candidateL & 0xffff), int(candidateL >> 16),
+			int(candidateS & 0xffff), int(candidateS >> 16),
+		} {
+			if n := matchAt(s, c); n.score > m.score {
+				m = n
+			}
+		}
+		return m
+	}
+
+	s := 1
+	for {
+		var m bestMatch
+		for {
+			nextS := s + (s-nextEmit)>>8 + 1
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			if m = find(s, m); m.length > 0 {
+				break
+			}
+			s = nextS
+		}
+		// Lazy matching: a later start may give a better match.
+		indexed := s
+		for indexed < s+2 && indexed < sLimit {
+			indexed++
+			m = find(indexed, m)
+		}
+
+		if nextEmit < m.s {
+			d += emitLiteral(dst[d:], src[nextEmit:m.s])
+		}
+		d += emitCopy(dst[d:], m.offset, m.length)
+		repeat = m.offset
+		s = m.s + m.length
+		nextEmit = s
+		if s >= sLimit {
+			goto emitRemainder
+		}
+
+		// Index the rest of the match.
+		if indexed < m.s {
+			indexed = m.s
+		}
+		for i := indexed + 1; i < s; i++ {
+			cv := le64(src, i)
+			hashL, hashS := hash7(cv, lTableBits), hash4(cv, sTableBits)
+			lTable[hashL] = uint32(i) | lTable[hashL]<<16
+			sTable[hashS] = uint32(i) | sTable[hashS]<<16
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		d += emitLiteral(dst[d:], src[nextEmit:])
+	}
+	return d
+}
@@ -0,0 +1,202 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// estimateBlocks is the number of blocks sampled by EstimateEncodedLen.
+const estimateBlocks = 4
+
+// EncodedLenBound returns an upper bound of the length of a block encoded
+// by Encode, EncodeBetter or EncodeBest, given its uncompressed length. It
+// is about 1% over srcLen, where MaxEncodedLen allows for 17%.
+//
+// Encode still needs MaxEncodedLen(srcLen) bytes of dst to encode in place,
+// as it uses the extra space for faster copies.
+//
+// It will return a negative value if srcLen is too large to encode.
+func EncodedLenBound(srcLen int) int {
+	n := uint64(srcLen)
+	if n > 0xffffffff {
+		return -1
+	}
+	// The encoders emit copies of at least 4 bytes, which take at most 3
+	// bytes, so only the literal headers can make the output grow. A block
+	// is a sequence of literal and copy pairs, followed by a literal of up to
+	// 3+65536 bytes. A pair of a literal of L bytes and a copy of C bytes
+	// takes at most L+C bytes if L <= 60, L+C+1 bytes if L <= 256, and
+	// L+C+2 bytes otherwise: at most 1 byte more for every 65 bytes.
+	blocks := (n + maxBlockSize - 1) / maxBlockSize
+	n += binary.MaxVarintLen32 + n/65 + 3*blocks
+	if n > 0xffffffff {
+		return -1
+	}
+	return int(n)
+}
+
+// EstimateEncodedLen returns an estimate of len(Encode(nil, src)). It runs
+// the match finding of Encode without emitting anything, with the same hash,
+// over the blocks of src, or over 4 evenly spaced blocks if there are more.
+// As Encode encodes each 64KB block independently, the result is exact for
+// inputs of up to 256KB.
+func EstimateEncodedLen(src []byte) int {
+	n := binary.PutUvarint(make([]byte, binary.MaxVarintLen64), uint64(len(src)))
+	if len(src) <= estimateBlocks*maxBlockSize {
+		return n + estimateBlock(src)
+	}
+	sampled := 0
+	sampleBlocks(src, func(b []byte) {
+		sampled += estimateBlock(b)
+	})
+	n += int(int64(sampled) * int64(len(src)) / (estimateBlocks * maxBlockSize))
+	if bound := EncodedLenBound(len(src)); n > bound {
+		n = bound
+	}
+	return n
+}
+
+// Compressible reports whether Encode is estimated to shrink src by at least
+// 12.5%, the saving under which a Writer stores a chunk uncompressed.
+func Compressible(src []byte) bool {
+	return EstimateEncodedLen(src) < len(src)-len(src)/8
+}
+
+// Entropy returns the order-0 entropy of src, in bits per byte, computed
+// over the same blocks as EstimateEncodedLen. Values close to 8 indicate
+// random or already compressed data.
+func Entropy(src []byte) float64 {
+	var counts [256]int
+	total := 0
+	count := func(b []byte) {
+		for _, c := range b {
+			counts[c]++
+		}
+		total += len(b)
+	}
+	if len(src) <= estimateBlocks*maxBlockSize {
+		count(src)
+	} else {
+		sampleBlocks(src, count)
+	}
+	if total == 0 {
+		return 0
+	}
+	var e float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+// sampleBlocks calls fn for estimateBlocks evenly spaced full blocks of src,
+// which must hold more than estimateBlocks blocks.
+func sampleBlocks(src []byte, fn func(block []byte)) {
+	full := len(src) / maxBlockSize
+	for i := 0; i < estimateBlocks; i++ {
+		start := i * (full - 1) / (estimateBlocks - 1) * maxBlockSize
+		fn(src[start : start+maxBlockSize])
+	}
+}
+
+// literalLen returns the number of bytes emitLiteral uses for n bytes.
+func literalLen(n int) int {
+	switch {
+	case n <= 60:
+		return n + 1
+	case n <= 1<<8:
+		return n + 2
+	}
+	return n + 3
+}
+
+// estimateBlock returns the number of bytes encodeBlock uses for src, split
+// in blocks of at most maxBlockSize bytes as by Encode.
+func estimateBlock(src []byte) (d int) {
+	for len(src) > maxBlockSize {
+		d += estimateBlock(src[:maxBlockSize])
+		src = src[maxBlockSize:]
+	}
+	if len(src) == 0 {
+		return d
+	}
+	if len(src) < minNonLiteralBlockSize {
+		return d + literalLen(len(src))
+	}
+
+	// The rest of the function follows encodeBlock in encode_other.go.
+	const (
+		maxTableSize = 1 << 14
+		tableMask    = maxTableSize - 1
+	)
+	shift := uint32(32 - 8)
+	for tableSize := 1 << 8; tableSize < maxTableSize && tableSize < len(src); tableSize *= 2 {
+		shift--
+	}
+	var table [maxTableSize]uint16
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> shift
+	}
+
+	sLimit := len(src) - inputMargin
+	nextEmit := 0
+	s := 1
+	nextHash := hash(le32(src, s))
+	for {
+		skip := 32
+		nextS := s
+		candidate := 0
+		for {
+			s = nextS
+			bytesBetweenHashLookups := skip >> 5
+			nextS = s + bytesBetweenHashLookups
+			skip += bytesBetweenHashLookups
+			if nextS > sLimit {
+				goto emitRemainder
+			}
+			candidate = int(table[nextHash&tableMask])
+			table[nextHash&tableMask] = uint16(s)
+			nextHash = hash(le32(src, nextS))
+			if le32(src, s) == le32(src, candidate) {
+				break
+			}
+		}
+
+		d += literalLen(s - nextEmit)
+		for {
+			base := s
+			s += 4
+			for i := candidate + 4; s < len(src) && src[i] == src[s]; i, s = i+1, s+1 {
+			}
+			d += copyCost(base-candidate, s-base)
+			nextEmit = s
+			if s >= sLimit {
+				goto emitRemainder
+			}
+
+			x := le64(src, s-1)
+			table[hash(uint32(x>>0))&tableMask] = uint16(s - 1)
+			currHash := hash(uint32(x >> 8))
+			candidate = int(table[currHash&tableMask])
+			table[currHash&tableMask] = uint16(s)
+			if uint32(x>>8) != le32(src, candidate) {
+				nextHash = hash(uint32(x >> 16))
+				s++
+				break
+			}
+		}
+	}
+
+emitRemainder:
+	if nextEmit < len(src) {
+		d += literalLen(len(src) - nextEmit)
+	}
+	return d
+}
@@ -0,0 +1,338 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+const (
+	// chunkTypeIndex is the skippable chunk holding an Index.
+	chunkTypeIndex = 0x99
+
+	indexHeader  = "snidx\x00"
+	indexTrailer = "\x00xdins"
+
+	// indexTrailerSize is the size of the chunk size and trailer
+	// at the end of an index chunk.
+	indexTrailerSize = 4 + len(indexTrailer)
+
+	// indexInterval is the minimum number of uncompressed bytes between
+	// index entries. Seeking decodes up to this much to reach an offset.
+	indexInterval = 1 << 20
+)
+
+var (
+	errIndex  = errors.New("snappy: invalid index")
+	errOffset = errors.New("snappy: invalid offset")
+)
+
+type indexEntry struct {
+	uncompressed, compressed int64
+}
+
+// An Index maps offsets in the uncompressed data of a framed stream to
+// the chunks holding them, for random access with a SeekableReader.
+//
+// A Writer records an index of the data written, and CloseIndex appends
+// it to the stream as a skippable chunk, where ReadIndex finds it.
+// The same bytes, as returned by MarshalBinary, can be stored separately.
+type Index struct {
+	// TotalUncompressed is the size of the uncompressed data.
+	TotalUncompressed int64
+	// TotalCompressed is the offset of the end of the indexed data
+	// in the stream, where the index chunk is written.
+	TotalCompressed int64
+
+	entries []indexEntry
+}
+
+// Find returns the offsets in the stream and in the uncompressed data of
+// the chunk to start decoding at, to reach the uncompressed offset.
+func (x *Index) Find(offset int64) (compressedOff, uncompressedOff int64, err error) {
+	if offset < 0 || offset > x.TotalUncompressed || len(x.entries) == 0 {
+		return 0, 0, errOffset
+	}
+	i := sort.Search(len(x.entries), func(i int) bool {
+		return x.entries[i].uncompressed > offset
+	}) - 1
+	if i < 0 {
+		return 0, 0, errOffset
+	}
+	return x.entries[i].compressed, x.entries[i].uncompressed, nil
+}
+
+// MarshalBinary encodes the index as a skippable chunk.
+func (x *Index) MarshalBinary() ([]byte, error) {
+	b := make([]byte, chunkHeaderSize, chunkHeaderSize+len(indexHeader)+3*binary.MaxVarintLen64+len(x.entries)*6+indexTrailerSize)
+	b = append(b, indexHeader...)
+	b = appendUvarint(b, uint64(x.TotalUncompressed))
+	b = appendUvarint(b, uint64(x.TotalCompressed))
+	b = appendUvarint(b, uint64(len(x.entries)))
+	var prev indexEntry
+	for _, e := range x.entries {
+		b = appendUvarint(b, uint64(e.uncompressed-prev.uncompressed))
+		b = appendUvarint(b, uint64(e.compressed-prev.compressed))
+		prev = e
+	}
+	size := len(b) + indexTrailerSize
+	if size-chunkHeaderSize > maxChunkLen {
+		return nil, errChunkTooLarge
+	}
+	b = append(b, uint8(size>>0), uint8(size>>8), uint8(size>>16), uint8(size>>24))
+	b = append(b, indexTrailer...)
+	n := size - chunkHeaderSize
+	b[0], b[1], b[2], b[3] = chunkTypeIndex, uint8(n>>0), uint8(n>>8), uint8(n>>16)
+	return b, nil
+}
+
+// UnmarshalBinary decodes an index chunk, as written by MarshalBinary.
+func (x *Index) UnmarshalBinary(b []byte) error {
+	if len(b) < chunkHeaderSize+len(indexHeader)+indexTrailerSize || b[0] != chunkTypeIndex ||
+		int(b[1])|int(b[2])<<8|int(b[3])<<16 != len(b)-chunkHeaderSize ||
+		string(b[chunkHeaderSize:chunkHeaderSize+len(indexHeader)]) != indexHeader ||
+		string(b[len(b)-len(indexTrailer):]) != indexTrailer {
+		return errIndex
+	}
+	b = b[chunkHeaderSize+len(indexHeader) : len(b)-indexTrailerSize]
+	var v [3]uint64
+	for i := range v {
+		n := 0
+		if v[i], n = binary.Uvarint(b); n <= 0 || v[i] > 1<<62 {
+			return errIndex
+		}
+		b = b[n:]
+	}
+	if v[2] > uint64(len(b))/2 {
+		return errIndex
+	}
+	entries := make([]indexEntry, v[2])
+	var prev indexEntry
+	for i := range entries {
+		du, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errIndex
+		}
+		b = b[n:]
+		dc, n := binary.Uvarint(b)
+		if n <= 0 || du > 1<<62 || dc > 1<<62 || i > 0 && du == 0 {
+			return errIndex
+		}
+		b = b[n:]
+		e := indexEntry{prev.uncompressed + int64(du), prev.compressed + int64(dc)}
+		if e.uncompressed > int64(v[0]) || e.compressed >= int64(v[1]) {
+			return errIndex
+		}
+		entries[i], prev = e, e
+	}
+	if len(b) != 0 || len(entries) > 0 && entries[0].uncompressed != 0 {
+		return errIndex
+	}
+	x.TotalUncompressed, x.TotalCompressed, x.entries = int64(v[0]), int64(v[1]), entries
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// ReadIndex reads the index chunk at the end of the stream of the given
+// size in r, as written by Writer.CloseIndex.
+func ReadIndex(r io.ReaderAt, size int64) (*Index, error) {
+	var tail [indexTrailerSize]byte
+	if size < int64(len(tail)) {
+		return nil, errIndex
+	}
+	if _, err := r.ReadAt(tail[:], size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+	n := int64(binary.LittleEndian.Uint32(tail[:4]))
+	if string(tail[4:]) != indexTrailer || n > size || n > maxChunkLen+chunkHeaderSize {
+		return nil, errIndex
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, size-n); err != nil {
+		return nil, err
+	}
+	x := new(Index)
+	if err := x.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// addIndex records a data chunk at the given offsets, if it is far
+// enough from the previous entry.
+func (w *Writer) addIndex(uncompressed, compressed int64) {
+	if n := len(w.index); n == 0 || uncompressed-w.index[n-1].uncompressed >= indexInterval {
+		w.index = append(w.index, indexEntry{uncompressed, compressed})
+	}
+}
+
+// Index flushes the Writer and returns an index of the data written.
+func (w *Writer) Index() (*Index, error) {
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	x := &Index{
+		TotalUncompressed: w.uncompressed,
+		TotalCompressed:   w.written,
+		entries:           append([]indexEntry(nil), w.index...),
+	}
+	if !w.wroteStreamHeader {
+		// The stream identifier is written before anything else.
+		x.TotalCompressed += int64(len(magicChunk))
+	}
+	return x, nil
+}
+
+// CloseIndex flushes the Writer, appends an index of the data as
+// a skippable chunk, and closes the Writer. It returns the index,
+// which may also be stored separately.
+func (w *Writer) CloseIndex() (*Index, error) {
+	x, err := w.Index()
+	if err != nil {
+		return nil, err
+	}
+	b, err := x.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.writeChunk(chunkTypeIndex, b[chunkHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return x, w.Close()
+}
+
+// A SeekableReader reads the uncompressed data of a framed stream in r
+// with random access, using an Index. It implements io.ReadSeeker and
+// io.ReaderAt. ReadAt may be called concurrently with other ReadAt calls.
+type SeekableReader struct {
+	r     io.ReaderAt
+	index *Index
+	pos   int64
+
+	dec    *Reader // decoding at decPos, or nil
+	decPos int64
+}
+
+// NewSeekableReader returns a SeekableReader for the stream of the given
+// size in r. If index is nil, it is read from the end of the stream.
+func NewSeekableReader(r io.ReaderAt, size int64, index *Index) (*SeekableReader, error) {
+	if index == nil {
+		var err error
+		if index, err = ReadIndex(r, size); err != nil {
+			return nil, err
+		}
+	}
+	if index.TotalCompressed > size {
+		return nil, errIndex
+	}
+	return &SeekableReader{r: r, index: index}, nil
+}
+
+var seekReaders sync.Pool
+
+// decoderAt returns a Reader positioned at the uncompressed offset,
+// which must be within the data.
+func (s *SeekableReader) decoderAt(dec *Reader, offset int64) (*Reader, error) {
+	comp, uncomp, err := s.index.Find(offset)
+	if err != nil {
+		return nil, err
+	}
+	sr := io.NewSectionReader(s.r, comp, s.index.TotalCompressed-comp)
+	if dec == nil {
+		dec = NewReader(sr)
+	} else {
+		dec.Reset(sr)
+	}
+	// Chunks are independent, so decoding can start at any chunk.
+	dec.readHeader = true
+	if _, err := io.CopyN(ioutil.Discard, dec, offset-uncomp); err != nil {
+		return nil, noEOF(err)
+	}
+	return dec, nil
+}
+
+// Read implements io.Reader.
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	if s.pos >= s.index.TotalUncompressed {
+		return 0, io.EOF
+	}
+	if s.dec == nil || s.decPos != s.pos {
+		dec, err := s.decoderAt(s.dec, s.pos)
+		if err != nil {
+			return 0, err
+		}
+		s.dec, s.decPos = dec, s.pos
+	}
+	if rem := s.index.TotalUncompressed - s.pos; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+	n, err := s.dec.Read(p)
+	s.pos += int64(n)
+	s.decPos = s.pos
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. Seeking past the end is allowed,
+// and reads there return io.EOF.
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.index.TotalUncompressed
+	default:
+		return 0, errors.New("snappy: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errOffset
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errOffset
+	}
+	if off >= s.index.TotalUncompressed {
+		return 0, io.EOF
+	}
+	dec, _ := seekReaders.Get().(*Reader)
+	dec, err := s.decoderAt(dec, off)
+	if err != nil {
+		return 0, err
+	}
+	defer seekReaders.Put(dec)
+	var eof error
+	if rem := s.index.TotalUncompressed - off; int64(len(p)) > rem {
+		p, eof = p[:rem], io.EOF
+	}
+	n, err := io.ReadFull(dec, p)
+	if err != nil {
+		return n, noEOF(err)
+	}
+	return n, eof
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 The Snappy-Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snappy
+
+import "errors"
+
+// maxChunkLen is the largest chunk length the framing format can express.
+const maxChunkLen = 1<<24 - 1
+
+var (
+	errSkippableType = errors.New("snappy: invalid skippable chunk type")
+	errChunkTooLarge = errors.New("snappy: chunk is too large")
+)
+
+// WriteSkippable flushes the buffered data and writes a skippable chunk
+// of the given type, which must be in the range 0x80-0xfd, holding data.
+// Readers that do not know the chunk type skip it, so skippable chunks
+// can carry metadata such as an index. A Reader passes them to the
+// function set with HandleSkippable.
+//
+// The data must be shorter than 16MB.
+func (w *Writer) WriteSkippable(chunkType byte, data []byte) error {
+	if chunkType < 0x80 || chunkType > 0xfd {
+		return errSkippableType
+	}
+	return w.writeChunk(chunkType, data)
+}
+
+// Pad flushes the buffered data and writes a padding chunk, so the total
+// number of bytes written to the underlying io.Writer is a multiple of
+// alignment. Padding chunks are at least four bytes long, so up to
+// alignment+3 bytes are written.
+func (w *Writer) Pad(alignment int) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if alignment <= 1 {
+		return nil
+	}
+	written := w.written
+	if !w.wroteStreamHeader {
+		written += int64(len(magicChunk))
+	}
+	n := int(int64(alignment)-written%int64(alignment)) % alignment
+	if n == 0 {
+		return nil
+	}
+	for n < chunkHeaderSize {
+		n += alignment
+	}
+	return w.writeChunk(chunkTypePadding, make([]byte, n-chunkHeaderSize))
+}
+
+// writeChunk writes a chunk with the given type and body,
+// after the buffered data.
+func (w *Writer) writeChunk(chunkType byte, body []byte) error {
+	if len(body) > maxChunkLen {
+		return errChunkTooLarge
+	}
+	var err error
+	if w.concurrency > 0 {
+		err = w.dispatch()
+	} else {
+		err = w.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 0, len(magicChunk)+chunkHeaderSize+len(body))
+	if !w.wroteStreamHeader {
+		w.wroteStreamHeader = true
+		b = append(b, magicChunk...)
+	}
+	b = append(b, chunkType, uint8(len(body)>>0), uint8(len(body)>>8), uint8(len(body)>>16))
+	b = append(b, body...)
+	if w.concurrency > 0 {
+		w.startOutput()
+		j := &encJob{out: b, done: make(chan struct{})}
+		close(j.done)
+		w.output <- j
+		return w.checkErr()
+	}
+	n, err := w.w.Write(b)
+	w.written += int64(n)
+	if err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// HandleSkippable sets a function that is called with the type and data
+// of each padding chunk (0xfe) and reserved skippable chunk (0x80-0xfd),
+// instead of discarding them. The data is only valid during the call.
+// If fn returns an error, Read returns it.
+//
+// HandleSkippable must be called before the first Read.
+func (r *Reader) HandleSkippable(fn func(chunkType byte, data []byte) error) {
+	r.skippableFunc = fn
+}
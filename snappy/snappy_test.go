@@ -7,6 +7,7 @@ package snappy
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,6 +20,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 var (
@@ -708,6 +710,353 @@ func TestEncodeNoiseThenRepeats(t *testing.T) {
 	}
 }
 
+func TestEncodeBetterBest(t *testing.T) {
+	tDir := filepath.FromSlash(*testdataDir)
+	text, err := ioutil.ReadFile(filepath.Join(tDir, goldenText))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	random, err := ioutil.ReadFile(filepath.Join(tDir, "random"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	inputs := [][]byte{nil, []byte("a"), text[:minNonLiteralBlockSize], text, random, bytes.Repeat([]byte{'x'}, 100000)}
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 20; i++ {
+		// Short runs copied from random earlier offsets.
+		b := make([]byte, 1+rng.Intn(100000))
+		rng.Read(b[:16])
+		for j := 16; j < len(b); {
+			n := copy(b[j:], b[rng.Intn(j):j][:1+rng.Intn(20)])
+			if rng.Intn(3) == 0 {
+				b[j] = byte(rng.Intn(256))
+			}
+			j += n
+		}
+		inputs = append(inputs, b)
+	}
+
+	for i, src := range inputs {
+		fast := Encode(nil, src)
+		for _, encode := range []func(dst, src []byte) []byte{EncodeBetter, EncodeBest} {
+			enc := encode(nil, src)
+			if len(enc) > MaxEncodedLen(len(src)) {
+				t.Fatalf("input %d: %d encoded bytes, more than MaxEncodedLen", i, len(enc))
+			}
+			got, err := Decode(nil, enc)
+			if err != nil {
+				t.Fatalf("input %d: Decode: %v", i, err)
+			}
+			if !bytes.Equal(got, src) {
+				t.Fatalf("input %d: roundtrip mismatch", i)
+			}
+			if len(src) > 1000 && len(enc) > len(fast) {
+				t.Errorf("input %d: %d encoded bytes, more than the %d of Encode", i, len(enc), len(fast))
+			}
+			// A too small dst is replaced.
+			if enc2 := encode(make([]byte, 10), src); !bytes.Equal(enc2, enc) {
+				t.Errorf("input %d: encoding depends on dst", i)
+			}
+		}
+	}
+
+	better, best := EncodeBetter(nil, text), EncodeBest(nil, text)
+	if fast := Encode(nil, text); len(better) >= len(fast) || len(best) >= len(better) {
+		t.Errorf("%s: got %d, %d and %d encoded bytes, want each level smaller", goldenText, len(fast), len(better), len(best))
+	}
+}
+
+func TestWriterLevel(t *testing.T) {
+	tDir := filepath.FromSlash(*testdataDir)
+	text, err := ioutil.ReadFile(filepath.Join(tDir, goldenText))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	text = bytes.Repeat(text, 3)
+	for _, concurrency := range []int{0, 2} {
+		var sizes []int
+		for _, level := range []Level{LevelFast, LevelBetter, LevelBest} {
+			var buf bytes.Buffer
+			w := NewBufferedWriter(&buf)
+			if concurrency > 0 {
+				w = NewConcurrentWriter(&buf, 0, concurrency)
+			}
+			if err := w.SetLevel(level); err != nil {
+				t.Fatal(err)
+			}
+			w.Write(text)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			sizes = append(sizes, buf.Len())
+			got, err := ioutil.ReadAll(NewReader(&buf))
+			if err != nil {
+				t.Fatalf("level %d: %v", level, err)
+			}
+			if !bytes.Equal(got, text) {
+				t.Fatalf("level %d: roundtrip mismatch", level)
+			}
+		}
+		if sizes[1] >= sizes[0] || sizes[2] >= sizes[1] {
+			t.Errorf("concurrency %d: stream sizes %v, want decreasing", concurrency, sizes)
+		}
+	}
+	if err := NewBufferedWriter(nil).SetLevel(LevelBest + 1); err != errLevel {
+		t.Errorf("SetLevel: got %v, want %v", err, errLevel)
+	}
+}
+
+func TestEstimateEncodedLen(t *testing.T) {
+	tDir := filepath.FromSlash(*testdataDir)
+	text, err := ioutil.ReadFile(filepath.Join(tDir, goldenText))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	random, err := ioutil.ReadFile(filepath.Join(tDir, "random"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	words := strings.Fields(string(text))
+	rng := rand.New(rand.NewSource(4))
+	var prose []byte
+	for len(prose) < 1<<20 {
+		prose = append(prose, words[rng.Intn(len(words))]...)
+		prose = append(prose, ' ')
+	}
+
+	// Up to 4 blocks, the estimate is exact.
+	for _, src := range [][]byte{nil, text[:1], text[:100], text, random[:4*maxBlockSize], prose[:200000]} {
+		if got, want := EstimateEncodedLen(src), len(Encode(nil, src)); got != want {
+			t.Errorf("%d bytes: got estimate %d, want %d", len(src), got, want)
+		}
+	}
+	// Including a short last block after full ones.
+	for k := 1; k < 4; k++ {
+		for n := k*maxBlockSize + 1; n <= k*maxBlockSize+minNonLiteralBlockSize+1; n++ {
+			for _, src := range [][]byte{random[:n], prose[:n]} {
+				if got, want := EstimateEncodedLen(src), len(Encode(nil, src)); got != want {
+					t.Errorf("%d bytes: got estimate %d, want %d", len(src), got, want)
+				}
+			}
+		}
+	}
+	if Compressible(random[:maxBlockSize+1]) {
+		t.Error("random data over one block: got compressible")
+	}
+	for _, src := range [][]byte{random, prose, prose[:300000], bytes.Repeat([]byte{0}, 1<<20)} {
+		got, want := EstimateEncodedLen(src), len(Encode(nil, src))
+		if got < want*9/10-16 || got > want*11/10+16 {
+			t.Errorf("%d bytes: got estimate %d, want %d within 10%%", len(src), got, want)
+		}
+		if bound := EncodedLenBound(len(src)); got > bound {
+			t.Errorf("%d bytes: estimate %d over bound %d", len(src), got, bound)
+		}
+	}
+
+	if Compressible(random) {
+		t.Error("random data: got compressible")
+	}
+	if !Compressible(prose) {
+		t.Error("text: got not compressible")
+	}
+	if e := Entropy(random); e < 7.9 || e > 8 {
+		t.Errorf("random data: got entropy %.3f, want about 8", e)
+	}
+	if e := Entropy(prose); e < 3 || e > 5 {
+		t.Errorf("text: got entropy %.3f, want 3 to 5", e)
+	}
+	if e := Entropy(bytes.Repeat([]byte{'a'}, 100)); e != 0 {
+		t.Errorf("repeated byte: got entropy %.3f, want 0", e)
+	}
+}
+
+func TestEncodedLenBound(t *testing.T) {
+	// Literals of 61 bytes each followed by a 4-byte copy from far away
+	// make the most of the literal headers.
+	worst := make([]byte, 0, 3*maxBlockSize)
+	rng := rand.New(rand.NewSource(5))
+	far := make([]byte, 4096)
+	rng.Read(far)
+	worst = append(worst, far...)
+	for len(worst)+65 < cap(worst) {
+		lit := make([]byte, 61)
+		rng.Read(lit)
+		off := rng.Intn(len(far) - 4)
+		worst = append(append(worst, lit...), far[off:off+4]...)
+	}
+	for _, src := range [][]byte{nil, {1}, worst, worst[:maxBlockSize+100]} {
+		bound := EncodedLenBound(len(src))
+		if bound > MaxEncodedLen(len(src)) {
+			t.Errorf("%d bytes: bound %d over MaxEncodedLen", len(src), bound)
+		}
+		for i, encode := range []func(dst, src []byte) []byte{Encode, EncodeBetter, EncodeBest} {
+			if n := len(encode(nil, src)); n > bound {
+				t.Errorf("%d bytes, encoder %d: %d encoded bytes over bound %d", len(src), i, n, bound)
+			}
+		}
+	}
+	// Lengths over 4GB only fit in a 64-bit int.
+	if n := uint64(1) << 33; uint64(int(n)) == n {
+		if got := EncodedLenBound(int(n)); got != -1 {
+			t.Errorf("EncodedLenBound(1<<33): got %d, want -1", got)
+		}
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	src := make([]byte, 1000)
+	for i := range src {
+		src[i] = byte(i % 7)
+	}
+	enc := Encode(nil, src)
+	if _, err := DecodeLimit(nil, enc, len(src)-1); err != ErrTooLarge {
+		t.Errorf("limit below length: got %v, want %v", err, ErrTooLarge)
+	}
+	dst := make([]byte, len(src))
+	got, err := DecodeLimit(dst, enc, len(dst))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, src) || &got[0] != &dst[0] {
+		t.Errorf("limit of len(dst): got %d bytes, want the %d bytes of src in dst", len(got), len(src))
+	}
+
+	// Lengths that the block is too short to decode to are rejected before
+	// allocating.
+	huge := []byte("\xff\xff\xff\xff\x07\x00\x00")
+	if n := testing.AllocsPerRun(10, func() {
+		if _, err := Decode(nil, huge); err != ErrCorrupt {
+			t.Fatalf("huge length: got %v, want %v", err, ErrCorrupt)
+		}
+	}); n != 0 {
+		t.Errorf("huge length: got %v allocations, want 0", n)
+	}
+}
+
+func TestReaderLimit(t *testing.T) {
+	data := make([]byte, 3*maxBlockSize+1000)
+	rand.New(rand.NewSource(6)).Read(data[:1000])
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf)
+	w.Write(data)
+	w.Close()
+
+	for _, concurrency := range []int{0, 2} {
+		for _, tc := range []struct {
+			limit   int64
+			want    int
+			wantErr error
+		}{
+			{0, len(data), nil},
+			{int64(len(data)), len(data), nil},
+			{int64(len(data) - 1), 3 * maxBlockSize, ErrLimit},
+			{maxBlockSize, maxBlockSize, ErrLimit},
+			{1, 0, ErrLimit},
+		} {
+			r := NewReader(bytes.NewReader(buf.Bytes()))
+			if concurrency > 0 {
+				r = NewConcurrentReader(bytes.NewReader(buf.Bytes()), concurrency)
+			}
+			r.SetLimit(tc.limit)
+			got, err := ioutil.ReadAll(r)
+			if err != tc.wantErr || !bytes.Equal(got, data[:tc.want]) {
+				t.Errorf("concurrency %d, limit %d: got %d bytes, %v, want %d bytes, %v",
+					concurrency, tc.limit, len(got), err, tc.want, tc.wantErr)
+			}
+			r.Close()
+
+			// Reset starts counting again.
+			if concurrency == 0 && tc.wantErr == nil {
+				r.Reset(bytes.NewReader(buf.Bytes()))
+				if n, err := io.Copy(ioutil.Discard, r); err != nil || n != int64(len(data)) {
+					t.Errorf("limit %d after Reset: got %d bytes, %v", tc.limit, n, err)
+				}
+			}
+		}
+	}
+}
+
+func TestDict(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	message := func() []byte {
+		return []byte(fmt.Sprintf(`{"id":%d,"user":{"name":"user%d","email":"user%d@example.com","verified":%t},`+
+			`"event":"page_view","path":"/products/%d","referrer":"https://www.example.com/search?q=item%d",`+
+			`"timestamp":"2016-11-%02dT%02d:%02d:%02dZ","tags":["web","mobile"]}`,
+			rng.Intn(1e6), rng.Intn(1000), rng.Intn(1000), rng.Intn(2) == 0, rng.Intn(500), rng.Intn(500),
+			1+rng.Intn(30), rng.Intn(24), rng.Intn(60), rng.Intn(60)))
+	}
+	var sample []byte
+	for i := 0; i < 20; i++ {
+		sample = append(sample, message()...)
+	}
+	dict, err := NewDict(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plain, withDict int
+	for i := 0; i < 100; i++ {
+		src := message()
+		enc := EncodeDict(nil, src, dict)
+		got, err := DecodeDict(nil, enc, dict)
+		if err != nil {
+			t.Fatalf("DecodeDict: %v", err)
+		}
+		if !bytes.Equal(got, src) {
+			t.Fatalf("roundtrip mismatch:\n%s\n%s", got, src)
+		}
+		plain += len(Encode(nil, src))
+		withDict += len(enc)
+	}
+	if withDict > plain/2 {
+		t.Errorf("got %d encoded bytes with the dictionary, want at most half of the %d without", withDict, plain)
+	}
+
+	random := make([]byte, 3*maxBlockSize)
+	rng.Read(random)
+	long := append(append([]byte(nil), sample...), random...)
+	long = append(long, sample...)
+	for _, src := range [][]byte{nil, []byte("a"), []byte("{\"id\":"), sample[:100], sample, long} {
+		enc := EncodeDict(nil, src, dict)
+		got, err := DecodeDict(nil, enc, dict)
+		if err != nil {
+			t.Fatalf("%d bytes: DecodeDict: %v", len(src), err)
+		}
+		if !bytes.Equal(got, src) {
+			t.Fatalf("%d bytes: roundtrip mismatch", len(src))
+		}
+		// Blocks without a dictionary decode too.
+		got, err = DecodeDict(make([]byte, 0, len(sample)+len(src)), Encode(nil, src), dict)
+		if err != nil || !bytes.Equal(got, src) {
+			t.Fatalf("%d bytes: DecodeDict of Encode output: %v", len(src), err)
+		}
+	}
+
+	// The start of a dictionary of MaxDictSize bytes is out of reach of
+	// all but the first bytes of the block.
+	big, err := NewDict(append(append([]byte(nil), random[:MaxDictSize-len(sample)]...), sample...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range [][]byte{random[:1000], append(message(), random[:200]...), long} {
+		got, err := DecodeDict(nil, EncodeDict(nil, src, big), big)
+		if err != nil || !bytes.Equal(got, src) {
+			t.Fatalf("%d bytes, large dictionary: roundtrip failed: %v", len(src), err)
+		}
+	}
+
+	// Copies from the dictionary are invalid without it.
+	if _, err := Decode(nil, EncodeDict(nil, sample[:100], dict)); err != ErrCorrupt {
+		t.Errorf("Decode without dictionary: got %v, want %v", err, ErrCorrupt)
+	}
+	if _, err := DecodeDict(nil, Encode(nil, sample), nil); err != errNilDict {
+		t.Errorf("DecodeDict with a nil dictionary: got %v, want %v", err, errNilDict)
+	}
+	if _, err := NewDict(make([]byte, MaxDictSize+1)); err != errDictTooLarge {
+		t.Errorf("NewDict: got %v, want %v", err, errDictTooLarge)
+	}
+}
+
 func TestFramingFormat(t *testing.T) {
 	// src is comprised of alternating 1e5-sized sequences of random
 	// (incompressible) bytes and repeated (compressible) bytes. 1e5 was chosen
@@ -955,6 +1304,411 @@ func TestFlush(t *testing.T) {
 	}
 }
 
+func TestConcurrentWriterReader(t *testing.T) {
+	var data []byte
+	rng := rand.New(rand.NewSource(1))
+	for len(data) < 3<<20 {
+		if rng.Intn(4) == 0 {
+			data = append(data, make([]byte, rng.Intn(5000))...)
+			rng.Read(data[len(data)-rng.Intn(100):])
+		} else {
+			data = append(data, fmt.Sprintf("line %d: %d\n", len(data), rng.Intn(1000))...)
+		}
+	}
+
+	// With 64KB chunks, the output is the same as without concurrency.
+	var want, got bytes.Buffer
+	w := NewBufferedWriter(&want)
+	w.Write(data)
+	w.Close()
+	w = NewConcurrentWriter(&got, 0, 4)
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("concurrent output differs: %d bytes, want %d", got.Len(), want.Len())
+	}
+
+	for _, blockSize := range []int{1, 1000, 4096, maxBlockSize, 1 << 20} {
+		in := data
+		if blockSize == 1 {
+			in = data[:20000]
+		}
+		var buf bytes.Buffer
+		w := NewConcurrentWriter(&buf, blockSize, 3)
+		for p := in; len(p) > 0; {
+			n := rng.Intn(200000)
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+			if rng.Intn(10) == 0 {
+				if err := w.Flush(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("x")); err != errClosed {
+			t.Errorf("Write after Close: %v, want %v", err, errClosed)
+		}
+		for _, r := range []*Reader{NewReader(bytes.NewReader(buf.Bytes())), NewConcurrentReader(bytes.NewReader(buf.Bytes()), 3)} {
+			dec, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("blockSize %d, concurrency %d: %v", blockSize, r.concurrency, err)
+			}
+			if err := cmp(dec, in); err != nil {
+				t.Errorf("blockSize %d, concurrency %d: %v", blockSize, r.concurrency, err)
+			}
+		}
+	}
+}
+
+func TestConcurrentReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf)
+	w.Write(bytes.Repeat([]byte("hello, world\n"), 100000))
+	w.Close()
+	in := buf.Bytes()
+
+	bad := append([]byte{}, in...)
+	bad[len(bad)/2] ^= 0xff
+	for name, b := range map[string][]byte{
+		"corrupt":   bad,
+		"truncated": in[:len(in)-3],
+		"no header": in[len(magicChunk):],
+	} {
+		r := NewConcurrentReader(bytes.NewReader(b), 2)
+		if _, err := io.Copy(ioutil.Discard, r); err != ErrCorrupt {
+			t.Errorf("%s: got %v, want %v", name, err, ErrCorrupt)
+		}
+	}
+
+	// Closing before the end must not block, and Reset starts over.
+	r := NewConcurrentReader(bytes.NewReader(in), 2)
+	p := make([]byte, 10)
+	if _, err := r.Read(p); err != nil {
+		t.Fatal(err)
+	}
+	r.Reset(bytes.NewReader(in))
+	if n, err := io.Copy(ioutil.Discard, r); err != nil || n != 1300000 {
+		t.Errorf("after Reset: %d, %v", n, err)
+	}
+	r.Close()
+	if _, err := r.Read(p); err != errReaderClosed {
+		t.Errorf("Read after Close: %v, want %v", err, errReaderClosed)
+	}
+}
+
+func TestSkippableChunks(t *testing.T) {
+	data := bytes.Repeat([]byte("some data "), 20000)
+	large := bytes.Repeat([]byte{'L'}, 100000) // larger than any data chunk
+	for _, concurrent := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewBufferedWriter(&buf)
+		if concurrent {
+			w = NewConcurrentWriter(&buf, 0, 2)
+		}
+		if err := w.WriteSkippable(0x80, []byte("meta")); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data[:1000])
+		if err := w.Pad(512); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len()%512 != 0 {
+			t.Errorf("concurrent %v: %d bytes after Pad(512)", concurrent, buf.Len())
+		}
+		w.Write(data[1000:])
+		if err := w.WriteSkippable(0xfd, large); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteSkippable(0x7f, nil); err != errSkippableType {
+			t.Errorf("WriteSkippable(0x7f): %v, want %v", err, errSkippableType)
+		}
+		if err := w.WriteSkippable(0xfe, nil); err != errSkippableType {
+			t.Errorf("WriteSkippable(0xfe): %v, want %v", err, errSkippableType)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Readers skip the chunks by default, or pass them on in order.
+		for _, r := range []*Reader{NewReader(bytes.NewReader(buf.Bytes())), NewConcurrentReader(bytes.NewReader(buf.Bytes()), 2)} {
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("concurrent %v: ReadAll = %d bytes, %v", concurrent, len(got), err)
+			}
+		}
+		for _, r := range []*Reader{NewReader(bytes.NewReader(buf.Bytes())), NewConcurrentReader(bytes.NewReader(buf.Bytes()), 2)} {
+			var events []string
+			var read int
+			r.HandleSkippable(func(chunkType byte, b []byte) error {
+				switch chunkType {
+				case 0x80:
+					events = append(events, fmt.Sprintf("meta %q at %d", b, read))
+				case chunkTypePadding:
+					events = append(events, fmt.Sprintf("padding at %d", read))
+				default:
+					if !bytes.Equal(b, large) {
+						t.Errorf("chunk %#x: wrong data", chunkType)
+					}
+					events = append(events, fmt.Sprintf("%#x at %d", chunkType, read))
+				}
+				return nil
+			})
+			p := make([]byte, 700)
+			for {
+				n, err := r.Read(p)
+				read += n
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want := []string{`meta "meta" at 0`, "padding at 1000", fmt.Sprintf("0xfd at %d", len(data))}
+			if fmt.Sprint(events) != fmt.Sprint(want) {
+				t.Errorf("concurrent %v/%d: events %q, want %q", concurrent, r.concurrency, events, want)
+			}
+		}
+	}
+
+	// A callback error stops reading.
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf)
+	w.WriteSkippable(0x99, nil)
+	w.Close()
+	errStop := fmt.Errorf("stop")
+	r := NewReader(&buf)
+	r.HandleSkippable(func(byte, []byte) error { return errStop })
+	if _, err := ioutil.ReadAll(r); err != errStop {
+		t.Errorf("got %v, want %v", err, errStop)
+	}
+}
+
+func TestSeekableReader(t *testing.T) {
+	data := make([]byte, 5<<20+12345)
+	rng := rand.New(rand.NewSource(1))
+	for i := range data {
+		data[i] = byte('a' + rng.Intn(4))
+	}
+	for _, concurrent := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewBufferedWriter(&buf)
+		if concurrent {
+			w = NewConcurrentWriter(&buf, 10000, 3)
+		}
+		for p := data; len(p) > 0; {
+			n := rng.Intn(300000)
+			if n > len(p) {
+				n = len(p)
+			}
+			w.Write(p[:n])
+			p = p[n:]
+		}
+		index, err := w.CloseIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if index.TotalUncompressed != int64(len(data)) || len(index.entries) < 5 {
+			t.Fatalf("index of %d bytes with %d entries", index.TotalUncompressed, len(index.entries))
+		}
+		stream := buf.Bytes()
+
+		// The index chunk is skipped by Readers.
+		if got, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream))); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("ReadAll = %d bytes, %v", len(got), err)
+		}
+
+		// The sidecar form decodes to the same index.
+		side, err := index.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var x Index
+		if err := x.UnmarshalBinary(side); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(x) != fmt.Sprint(*index) {
+			t.Errorf("UnmarshalBinary = %v, want %v", x, *index)
+		}
+		if !bytes.HasSuffix(stream, side) {
+			t.Errorf("stream does not end with the index")
+		}
+
+		s, err := NewSeekableReader(bytes.NewReader(stream), int64(len(stream)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 5000)
+		for i := 0; i < 50; i++ {
+			off := rng.Int63n(int64(len(data)))
+			if i%2 == 0 {
+				if _, err := s.Seek(off, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				n, err := io.ReadFull(s, p)
+				if err != nil && !(err == io.ErrUnexpectedEOF && off+int64(n) == int64(len(data))) {
+					t.Fatalf("Read at %d: %v", off, err)
+				}
+				if !bytes.Equal(p[:n], data[off:off+int64(n)]) {
+					t.Fatalf("Read at %d: wrong data", off)
+				}
+			} else {
+				n, err := s.ReadAt(p, off)
+				if n < len(p) && err != io.EOF || n == len(p) && err != nil {
+					t.Fatalf("ReadAt %d: %d, %v", off, n, err)
+				}
+				if !bytes.Equal(p[:n], data[off:off+int64(n)]) {
+					t.Fatalf("ReadAt %d: wrong data", off)
+				}
+			}
+		}
+		if pos, _ := s.Seek(-10, io.SeekEnd); pos != int64(len(data))-10 {
+			t.Errorf("Seek from end = %d", pos)
+		}
+		if rest, err := ioutil.ReadAll(s); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+			t.Errorf("reading the end: %q, %v", rest, err)
+		}
+	}
+
+	// Streams without an index are rejected.
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf)
+	w.Write(data[:1000])
+	w.Close()
+	if _, err := ReadIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != errIndex {
+		t.Errorf("ReadIndex without index: %v, want %v", err, errIndex)
+	}
+}
+
+// errWriter fails after n bytes.
+type errWriter struct {
+	n   int
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, w.err
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestReadFromWriteTo(t *testing.T) {
+	var data []byte
+	rng := rand.New(rand.NewSource(2))
+	for len(data) < 1<<20 {
+		data = append(data, fmt.Sprintf("entry %d: %d\n", len(data), rng.Intn(100))...)
+	}
+
+	var want bytes.Buffer
+	w := NewBufferedWriter(&want)
+	w.Write(data)
+	w.Close()
+
+	writers := []struct {
+		name string
+		new  func(io.Writer) *Writer
+	}{
+		{"unbuffered", NewWriter},
+		{"buffered", NewBufferedWriter},
+		{"concurrent", func(w io.Writer) *Writer { return NewConcurrentWriter(w, 0, 3) }},
+	}
+	for _, tc := range writers {
+		var buf bytes.Buffer
+		w := tc.new(&buf)
+		w.Write(data[:100])
+		n, err := w.ReadFrom(iotest.HalfReader(bytes.NewReader(data[100:])))
+		if err != nil || n != int64(len(data)-100) {
+			t.Fatalf("%s: ReadFrom: %d, %v", tc.name, n, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", tc.name, err)
+		}
+		if tc.name != "unbuffered" && !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Errorf("%s: output differs from Write", tc.name)
+		}
+
+		for _, concurrency := range []int{0, 2} {
+			var got bytes.Buffer
+			r := NewReader(bytes.NewReader(buf.Bytes()))
+			if concurrency > 0 {
+				r = NewConcurrentReader(bytes.NewReader(buf.Bytes()), concurrency)
+			}
+			var b [10]byte
+			r.Read(b[:])
+			got.Write(b[:])
+			n, err := r.WriteTo(&got)
+			if err != nil || n != int64(len(data)-len(b)) {
+				t.Fatalf("%s/%d: WriteTo: %d, %v", tc.name, concurrency, n, err)
+			}
+			if !bytes.Equal(got.Bytes(), data) {
+				t.Fatalf("%s/%d: WriteTo output differs", tc.name, concurrency)
+			}
+		}
+	}
+
+	// ReadFrom reports errors from the source.
+	w = NewBufferedWriter(ioutil.Discard)
+	if _, err := w.ReadFrom(iotest.TimeoutReader(bytes.NewReader(data))); err != iotest.ErrTimeout {
+		t.Errorf("ReadFrom: %v, want %v", err, iotest.ErrTimeout)
+	}
+	errWrite := errors.New("write failed")
+	w = NewConcurrentWriter(&errWriter{n: 1000, err: errWrite}, 0, 2)
+	if _, err := w.ReadFrom(bytes.NewReader(data)); err == nil {
+		// The error may only be seen once the output is written.
+		if err = w.Close(); err != errWrite {
+			t.Errorf("concurrent ReadFrom to failing writer: Close: %v, want %v", err, errWrite)
+		}
+	} else if err != errWrite {
+		t.Errorf("concurrent ReadFrom to failing writer: %v, want %v", err, errWrite)
+	}
+
+	// WriteTo reports errors from the destination and from the stream.
+	corrupt := append([]byte(nil), want.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	for _, concurrency := range []int{0, 2} {
+		newReader := func(b []byte) *Reader {
+			if concurrency > 0 {
+				return NewConcurrentReader(bytes.NewReader(b), concurrency)
+			}
+			return NewReader(bytes.NewReader(b))
+		}
+		r := newReader(want.Bytes())
+		n, err := r.WriteTo(&errWriter{n: 100000, err: errWrite})
+		if err != errWrite || n != 100000 {
+			t.Errorf("%d: WriteTo to failing writer: %d, %v", concurrency, n, err)
+		}
+		r.Close()
+
+		r = newReader(corrupt)
+		if _, err := r.WriteTo(ioutil.Discard); err != ErrCorrupt {
+			t.Errorf("%d: WriteTo corrupt stream: %v, want %v", concurrency, err, ErrCorrupt)
+		}
+	}
+
+	var got bytes.Buffer
+	n, err := DecodeConcurrent(&got, bytes.NewReader(want.Bytes()), 0)
+	if err != nil || n != int64(len(data)) || !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("DecodeConcurrent: %d, %v", n, err)
+	}
+}
+
 func TestReaderUncompressedDataOK(t *testing.T) {
 	r := NewReader(strings.NewReader(magicChunk +
 		"\x01\x08\x00\x00" + // Uncompressed chunk, 8 bytes long (including 4 byte checksum).
@@ -0,0 +1,172 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package targz creates and extracts gzip compressed tar archives,
+// commonly named .tar.gz or .tgz, combining archive/tar with the gzip
+// package.
+//
+// Create and CreateDir write the archive of a directory tree in one call,
+// and Extract unpacks one, guarding against entries that escape the
+// target directory and against archives that expand beyond given limits.
+//
+// Only gzip compression is supported. The snappy package implements the
+// snappy framing format, which tar tools do not read, so tar archives
+// compressed with it are out of scope.
+package targz
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/internal/archive"
+)
+
+// SymlinkMode controls how Create handles symbolic links.
+type SymlinkMode = archive.SymlinkMode
+
+const (
+	// SymlinkStore stores a link as a symbolic link entry.
+	SymlinkStore = archive.SymlinkStore
+
+	// SymlinkFollow stores the file or directory the link points to.
+	// Links to a directory being added, which would loop, are skipped.
+	SymlinkFollow = archive.SymlinkFollow
+
+	// SymlinkSkip leaves links out of the archive.
+	SymlinkSkip = archive.SymlinkSkip
+)
+
+// CreateOptions controls which files Create adds to the archive and how
+// their headers are set. The zero value adds all files with their own
+// modification times and permissions.
+type CreateOptions struct {
+	// Include holds path.Match patterns. If it is not empty, only
+	// files and links matching one of the patterns are added.
+	// Patterns containing a slash are matched against the full
+	// slash-separated path, other patterns against the base name.
+	Include []string
+
+	// Exclude holds patterns, like Include, of files, links and
+	// directories to leave out. Excluded directories are not walked.
+	Exclude []string
+
+	// Symlinks selects how symbolic links are handled.
+	Symlinks SymlinkMode
+
+	// ModTime, if not zero, is used as modification time of all
+	// entries and of the gzip header, instead of the times reported
+	// by the file system.
+	ModTime time.Time
+
+	// NormalizeModes stores directories and executable files with
+	// mode 0755, other files with mode 0644 and links with 0777,
+	// regardless of the permissions in the file system.
+	NormalizeModes bool
+}
+
+// Create writes a gzip compressed tar archive of the directory tree of
+// fsys to w, at the given gzip compression level. The tree is walked in
+// lexical order using fs.WalkDir. Files that are neither regular files,
+// directories nor links are skipped.
+//
+// Owners are not recorded, so with a fixed ModTime and NormalizeModes the
+// archive only depends on the names and contents of the files, and
+// repeated runs produce identical archives.
+//
+// Storing links requires fsys to provide a ReadLink method like the one
+// of os.DirFS in recent Go versions; see also CreateDir.
+func Create(w io.Writer, fsys fs.FS, level int, opts *CreateOptions) error {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	zw.ModTime = opts.ModTime
+	tw := tar.NewWriter(zw)
+	a := &fsAdder{w: tw, fsys: fsys, opts: opts}
+	aw := &archive.Walker{
+		Include:  opts.Include,
+		Exclude:  opts.Exclude,
+		Symlinks: opts.Symlinks,
+		Dir:      a.addDir,
+		File:     a.addFile,
+		Link:     a.addLink,
+	}
+	if err := aw.Walk(fsys); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// CreateDir writes an archive of the directory tree rooted at dir,
+// as Create. Entry names are relative to dir.
+func CreateDir(w io.Writer, dir string, level int, opts *CreateOptions) error {
+	return Create(w, archive.DirFS(dir), level, opts)
+}
+
+type fsAdder struct {
+	w    *tar.Writer
+	fsys fs.FS
+	opts *CreateOptions
+}
+
+func (a *fsAdder) addDir(name string, fi fs.FileInfo) error {
+	return a.w.WriteHeader(a.header(name, fi))
+}
+
+func (a *fsAdder) addLink(name string, fi fs.FileInfo, target string) error {
+	hdr := a.header(name, fi)
+	hdr.Linkname = target
+	return a.w.WriteHeader(hdr)
+}
+
+func (a *fsAdder) addFile(name string, fi fs.FileInfo) error {
+	f, err := a.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hdr := a.header(name, fi)
+	hdr.Size = fi.Size()
+	if err := a.w.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// The size is fixed by the header, even if the file changes.
+	if _, err := io.CopyN(a.w, f, hdr.Size); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (a *fsAdder) header(name string, fi fs.FileInfo) *tar.Header {
+	hdr := &tar.Header{Name: name, ModTime: a.opts.ModTime}
+	if hdr.ModTime.IsZero() {
+		hdr.ModTime = fi.ModTime()
+	}
+	mode := fi.Mode()
+	if a.opts.NormalizeModes {
+		mode = archive.NormalMode(mode)
+	}
+	switch {
+	case mode.IsDir():
+		hdr.Typeflag = tar.TypeDir
+	case mode&fs.ModeSymlink != 0:
+		hdr.Typeflag = tar.TypeSymlink
+	default:
+		hdr.Typeflag = tar.TypeReg
+	}
+	hdr.Mode = int64(mode.Perm())
+	return hdr
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package targz
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/internal/archive"
+)
+
+var (
+	ErrInsecurePath = errors.New("targz: insecure file path")
+	ErrLimit        = errors.New("targz: extraction limit exceeded")
+)
+
+// ExtractOptions sets the limits and behavior of Extract.
+// The zero value applies no limits and rejects links.
+type ExtractOptions struct {
+	// MaxFiles limits the number of entries in the archive.
+	MaxFiles int
+
+	// MaxTotalSize limits the total number of bytes written.
+	MaxTotalSize int64
+
+	// MaxRatio limits the ratio of the bytes written to the compressed
+	// bytes read. It is checked once the output exceeds 1MB.
+	MaxRatio float64
+
+	// Symlinks allows symbolic and hard link entries, as long as they
+	// point to a location inside the target directory. If false,
+	// archives containing links are rejected.
+	Symlinks bool
+
+	// SkipModes and SkipTimes disable restoring the permission bits and
+	// modification times of the entries.
+	SkipModes bool
+	SkipTimes bool
+}
+
+// Extract reads a gzip compressed tar archive from r and writes its
+// contents into the directory dir, which is created if needed. Entries
+// other than regular files, directories and links are rejected.
+//
+// Entry names must be relative paths that stay inside dir, and entries
+// are never written through symbolic links, whether they come from the
+// archive or already exist in dir. Violations return an *fs.PathError
+// wrapping ErrInsecurePath, and exceeding a limit in opts one wrapping
+// ErrLimit. Extraction stops at the first error, leaving the entries
+// written so far in place.
+//
+// Unless disabled in opts, permission bits and modification times are
+// restored. Setuid, setgid and sticky bits and owners are never restored.
+// Otherwise, for entries without any permission bits, and for directories
+// only implied by the names of other entries, the permission bits are
+// those of os.Create and os.MkdirAll, filtered by the umask.
+func Extract(r io.Reader, dir string, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	cr := &countReader{r: r}
+	zr, err := gzip.NewReader(cr)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	e := &archive.Extractor{
+		Dir:             dir,
+		Symlinks:        opts.Symlinks,
+		MaxTotalSize:    opts.MaxTotalSize,
+		MaxRatio:        opts.MaxRatio,
+		SkipModes:       opts.SkipModes,
+		SkipTimes:       opts.SkipTimes,
+		ErrInsecurePath: ErrInsecurePath,
+		ErrLimit:        ErrLimit,
+	}
+	tr := tar.NewReader(zr)
+	for files := 0; ; files++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if opts.MaxFiles > 0 && files >= opts.MaxFiles {
+			return &fs.PathError{Op: "extract", Path: hdr.Name, Err: ErrLimit}
+		}
+		if err := extract(e, hdr, tr, cr); err != nil {
+			return err
+		}
+	}
+	return e.FinishDirs()
+}
+
+// countReader counts the compressed bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func extract(e *archive.Extractor, hdr *tar.Header, r io.Reader, in *countReader) error {
+	name, err := e.LocalName(hdr.Name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		// The root itself, as written by "tar -C dir .".
+		return nil
+	}
+	if err := e.CheckParents(name); err != nil {
+		return err
+	}
+	target := e.Target(name)
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := e.Mkdir(name); err != nil {
+			return err
+		}
+		e.AddDir(name, fs.FileMode(hdr.Mode), hdr.ModTime)
+		return nil
+	case tar.TypeSymlink:
+		link, err := e.CheckLink(hdr.Name, path.Dir(name), hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(filepath.FromSlash(link), target)
+	case tar.TypeLink:
+		return hardLink(e, hdr, target)
+	case tar.TypeReg:
+	case tar.TypeXGlobalHeader:
+		return nil
+	default:
+		return &fs.PathError{Op: "extract", Path: hdr.Name, Err: errors.New("targz: unsupported file type")}
+	}
+
+	w, err := e.Create(hdr.Name, target)
+	if err != nil {
+		return err
+	}
+	// The whole archive is one gzip stream, so the ratio is checked on
+	// the totals.
+	lw := e.LimitWriter(w, hdr.Name, func(int64) (int64, int64) {
+		return e.Written, in.n
+	})
+	_, err = io.Copy(lw, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return e.Restore(target, fs.FileMode(hdr.Mode), hdr.ModTime)
+}
+
+// hardLink creates a hard link. Unlike symbolic links, the target of a
+// hard link is relative to the archive root, and must be a regular
+// file extracted before, in real directories.
+func hardLink(e *archive.Extractor, hdr *tar.Header, target string) error {
+	link, err := e.CheckLink(hdr.Name, ".", hdr.Linkname)
+	if err != nil {
+		return err
+	}
+	if !e.IsReal(path.Dir(link)) {
+		return &fs.PathError{Op: "extract", Path: hdr.Name, Err: ErrInsecurePath}
+	}
+	old := e.Target(link)
+	if fi, err := os.Lstat(old); err != nil || !fi.Mode().IsRegular() {
+		return &fs.PathError{Op: "extract", Path: hdr.Name, Err: ErrInsecurePath}
+	}
+	return os.Link(old, target)
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+)
+
+func TestCreateExtract(t *testing.T) {
+	src := t.TempDir()
+	for name, data := range map[string]string{
+		"a/b/c.txt":  "hello",
+		"a/run":      "#!/bin/sh",
+		"a/skip.tmp": "excluded",
+		"d/e.txt":    strings.Repeat("data ", 1000),
+	} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(filepath.Join(src, "a", "run"), 0750)
+	if err := os.Symlink("b/c.txt", filepath.Join(src, "a", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	opts := &CreateOptions{Exclude: []string{"*.tmp"}, ModTime: mtime, NormalizeModes: true}
+	var archive, again bytes.Buffer
+	if err := CreateDir(&archive, src, gzip.BestSpeed, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateDir(&again, src, gzip.BestSpeed, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(archive.Bytes(), again.Bytes()) {
+		t.Error("archives of the same tree differ")
+	}
+
+	dst := t.TempDir()
+	if err := Extract(bytes.NewReader(archive.Bytes()), dst, &ExtractOptions{Symlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"a":         os.ModeDir | 0755,
+		"a/b/c.txt": 0644,
+		"a/run":     0755,
+		"a/link":    os.ModeSymlink | 0777,
+		"d/e.txt":   0644,
+	} {
+		fi, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode() != want {
+			t.Errorf("%s: mode %v, want %v", name, fi.Mode(), want)
+		}
+		if fi.Mode()&os.ModeSymlink == 0 && !fi.ModTime().Equal(mtime) {
+			t.Errorf("%s: mtime %v, want %v", name, fi.ModTime(), mtime)
+		}
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "a", "skip.tmp")); !os.IsNotExist(err) {
+		t.Errorf("excluded file extracted: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dst, "a", "link"))
+	if err != nil || string(b) != "hello" {
+		t.Errorf("reading link = %q, %v", b, err)
+	}
+
+	// Links are rejected unless allowed.
+	err = Extract(bytes.NewReader(archive.Bytes()), t.TempDir(), nil)
+	if !errors.Is(err, ErrInsecurePath) {
+		t.Errorf("got error %v, want %v", err, ErrInsecurePath)
+	}
+}
+
+type entry struct {
+	Name     string
+	Type     byte
+	Contents string // or link target
+}
+
+func tarGz(t *testing.T, entries []entry) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.Name, Typeflag: e.Type, Mode: 0644}
+		switch e.Type {
+		case tar.TypeSymlink, tar.TypeLink:
+			hdr.Linkname = e.Contents
+		case tar.TypeReg:
+			hdr.Size = int64(len(e.Contents))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if e.Type == tar.TypeReg {
+			tw.Write([]byte(e.Contents))
+		}
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+// defaultModes returns the modes of a new directory and file,
+// as filtered by the umask.
+func defaultModes(t *testing.T) (dir, file os.FileMode) {
+	p := filepath.Join(t.TempDir(), "x")
+	if err := os.Mkdir(p, 0777); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(p, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	di, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return di.Mode(), fi.Mode()
+}
+
+func TestExtractModes(t *testing.T) {
+	dirMode, fileMode := defaultModes(t)
+	in := tarGz(t, []entry{{"a/b/c.txt", tar.TypeReg, "hello"}})
+	for _, opts := range []*ExtractOptions{nil, {SkipModes: true}} {
+		dir := t.TempDir()
+		if err := Extract(bytes.NewReader(in), dir, opts); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]os.FileMode{"a": dirMode, "a/b": dirMode, "a/b/c.txt": 0644}
+		if opts != nil {
+			want["a/b/c.txt"] = fileMode
+		}
+		for name, want := range want {
+			fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != want {
+				t.Errorf("%+v: %s: mode %v, want %v", opts, name, fi.Mode(), want)
+			}
+		}
+	}
+}
+
+func TestExtractInsecure(t *testing.T) {
+	for _, entries := range [][]entry{
+		{{"../evil", tar.TypeReg, ""}},
+		{{"a/../../evil", tar.TypeReg, ""}},
+		{{"/evil", tar.TypeReg, ""}},
+		{{`..\evil`, tar.TypeReg, ""}},
+		{{"link", tar.TypeSymlink, "../evil"}},
+		{{"link", tar.TypeSymlink, "/etc/passwd"}},
+		{{"a/link", tar.TypeSymlink, "b/../../.."}},
+		{{"hard", tar.TypeLink, "../evil"}},
+		{{"hard", tar.TypeLink, "missing"}},
+		// Writing through a link pointing inside is not allowed either.
+		{{"dot", tar.TypeSymlink, "."}, {"dot/escape", tar.TypeSymlink, "../evil"}},
+		{{"dot", tar.TypeSymlink, "."}, {"dot", tar.TypeReg, "overwrite"}},
+		{{"dot", tar.TypeSymlink, "."}, {"hard", tar.TypeLink, "dot/x"}},
+	} {
+		err := Extract(bytes.NewReader(tarGz(t, entries)), t.TempDir(), &ExtractOptions{Symlinks: true})
+		if !errors.Is(err, ErrInsecurePath) {
+			t.Errorf("%q: got error %v, want %v", entries[len(entries)-1].Name, err, ErrInsecurePath)
+		}
+	}
+
+	// Hard links to extracted files are fine.
+	dir := t.TempDir()
+	in := tarGz(t, []entry{{"a", tar.TypeReg, "data"}, {"b", tar.TypeLink, "a"}})
+	if err := Extract(bytes.NewReader(in), dir, &ExtractOptions{Symlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "b")); err != nil || string(b) != "data" {
+		t.Errorf("reading hard link = %q, %v", b, err)
+	}
+
+	in = tarGz(t, []entry{{"fifo", tar.TypeFifo, ""}})
+	if err := Extract(bytes.NewReader(in), t.TempDir(), nil); err == nil {
+		t.Error("fifo extracted")
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	big := strings.Repeat("a", 4<<20)
+	in := tarGz(t, []entry{{"one", tar.TypeReg, "1"}, {"two", tar.TypeReg, "2"}, {"big", tar.TypeReg, big}})
+	for _, opts := range []*ExtractOptions{
+		{MaxFiles: 2},
+		{MaxTotalSize: 1 << 20},
+		{MaxRatio: 100},
+	} {
+		if err := Extract(bytes.NewReader(in), t.TempDir(), opts); !errors.Is(err, ErrLimit) {
+			t.Errorf("%+v: got error %v, want %v", opts, err, ErrLimit)
+		}
+	}
+	if err := Extract(bytes.NewReader(in), t.TempDir(), &ExtractOptions{MaxFiles: 3, MaxTotalSize: 5 << 20}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/klauspost/compress/internal/archive"
+)
+
+// SymlinkMode controls how AddFS handles symbolic links.
+type SymlinkMode = archive.SymlinkMode
+
+const (
+	// SymlinkStore stores a link as an entry with mode os.ModeSymlink
+	// and the link target as contents, as Info-ZIP does.
+	SymlinkStore = archive.SymlinkStore
+
+	// SymlinkFollow stores the file or directory the link points to.
+	// Links to a directory being added, which would loop, are skipped.
+	SymlinkFollow = archive.SymlinkFollow
+
+	// SymlinkSkip leaves links out of the archive.
+	SymlinkSkip = archive.SymlinkSkip
+)
+
+// AddOptions controls which files AddFS adds to an archive and how
+// their headers are set. The zero value adds all files, uncompressed,
+// with their own modification times and permissions.
+type AddOptions struct {
+	// Include holds path.Match patterns. If it is not empty, only
+	// files and links matching one of the patterns are added.
+	// Patterns containing a slash are matched against the full
+	// slash-separated path, other patterns against the base name.
+	Include []string
+
+	// Exclude holds patterns, like Include, of files, links and
+	// directories to leave out. Excluded directories are not walked.
+	Exclude []string
+
+	// Symlinks selects how symbolic links are handled.
+	Symlinks SymlinkMode
+
+	// Method is the compression method used for files.
+	// Directories and links are always stored.
+	Method uint16
+
+	// ModTime, if not zero, is used as modification time of all
+	// entries instead of the times reported by the file system.
+	ModTime time.Time
+
+	// NormalizeModes stores directories and executable files with
+	// mode 0755, other files with mode 0644 and links with 0777,
+	// regardless of the permissions in the file system.
+	NormalizeModes bool
+}
+
+// AddFS adds the directory tree of fsys to the archive, walking it in
+// lexical order using fs.WalkDir. Directories get entries with names
+// ending in a slash. Files that are neither regular files, directories
+// nor links are skipped.
+//
+// Entries are written in a deterministic order, and with a fixed ModTime
+// and NormalizeModes the archive only depends on the names and contents
+// of the files, so repeated runs produce identical archives.
+//
+// Storing links requires fsys to provide a ReadLink method like the one
+// of os.DirFS in recent Go versions; see also AddDir.
+func (w *Writer) AddFS(fsys fs.FS, opts *AddOptions) error {
+	if opts == nil {
+		opts = &AddOptions{}
+	}
+	a := &fsAdder{w: w, fsys: fsys, opts: opts, buf: make([]byte, 64<<10)}
+	aw := &archive.Walker{
+		Include:  opts.Include,
+		Exclude:  opts.Exclude,
+		Symlinks: opts.Symlinks,
+		Dir:      a.addDir,
+		File:     a.addFile,
+		Link:     a.addLink,
+	}
+	return aw.Walk(fsys)
+}
+
+// AddDir adds the directory tree rooted at dir to the archive, as AddFS.
+// Entry names are relative to dir.
+func (w *Writer) AddDir(dir string, opts *AddOptions) error {
+	return w.AddFS(archive.DirFS(dir), opts)
+}
+
+type fsAdder struct {
+	w    *Writer
+	fsys fs.FS
+	opts *AddOptions
+	buf  []byte
+}
+
+func (a *fsAdder) addDir(name string, fi fs.FileInfo) error {
+	_, err := a.w.CreateHeader(a.header(name, fi, Store))
+	return err
+}
+
+func (a *fsAdder) addLink(name string, fi fs.FileInfo, target string) error {
+	fw, err := a.w.CreateHeader(a.header(name, fi, Store))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(fw, target)
+	return err
+}
+
+func (a *fsAdder) addFile(name string, fi fs.FileInfo) error {
+	f, err := a.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw, err := a.w.CreateHeader(a.header(name, fi, a.opts.Method))
+	if err != nil {
+		return err
+	}
+	// Write in fixed size chunks, so the compressed output does not
+	// depend on how much each Read returns.
+	for {
+		n, err := io.ReadFull(f, a.buf)
+		if n > 0 {
+			if _, err := fw.Write(a.buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (a *fsAdder) header(name string, fi fs.FileInfo, method uint16) *FileHeader {
+	fh := &FileHeader{Name: name, Method: method}
+	mtime := a.opts.ModTime
+	if mtime.IsZero() {
+		mtime = fi.ModTime()
+	}
+	fh.SetModTime(mtime)
+	mode := fi.Mode()
+	if a.opts.NormalizeModes {
+		mode = archive.NormalMode(mode)
+	}
+	fh.SetMode(mode)
+	return fh
+}
@@ -0,0 +1,36 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import "unicode/utf8"
+
+// cp437 maps the upper half of code page 437 to Unicode.
+// The lower half is identical to ASCII for file name purposes.
+var cp437 = []rune("" +
+	"ÇüéâäàåçêëèïîìÄÅ" +
+	"ÉæÆôöòûùÿÖÜ¢£¥₧ƒ" +
+	"áíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐" +
+	"└┴┬├─┼╞╟╚╔╩╦╠═╬╧" +
+	"╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩" +
+	"≡±≥≤⌠⌡÷≈°∙·√ⁿ²■\u00a0")
+
+// DecodeCP437 is a NameDecoder for code page 437, the encoding the
+// zip specification assumes for names without the UTF-8 flag.
+// It never returns an error.
+func DecodeCP437(b []byte) (string, error) {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c < utf8.RuneSelf {
+			buf = append(buf, c)
+			continue
+		}
+		var enc [utf8.UTFMax]byte
+		n := utf8.EncodeRune(enc[:], cp437[c-utf8.RuneSelf])
+		buf = append(buf, enc[:n]...)
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/klauspost/compress/internal/archive"
+)
+
+var (
+	ErrInsecurePath = errors.New("zip: insecure file path")
+	ErrLimit        = errors.New("zip: extraction limit exceeded")
+)
+
+// maxLinkTarget is the longest symbolic link target Extract accepts.
+const maxLinkTarget = 4096
+
+// ExtractOptions sets the limits and behavior of Extract.
+// The zero value applies no limits and rejects symbolic links.
+type ExtractOptions struct {
+	// MaxFiles limits the number of entries in the archive.
+	MaxFiles int
+
+	// MaxTotalSize limits the total number of bytes written.
+	MaxTotalSize int64
+
+	// MaxRatio limits the ratio of decompressed to compressed size of
+	// each file. It is checked against the bytes actually decompressed
+	// once a file exceeds 1MB, not against the sizes in the header.
+	MaxRatio float64
+
+	// Symlinks allows entries with os.ModeSymlink to be created as
+	// symbolic links, as long as they point to a location inside the
+	// target directory. If false, archives containing links are rejected.
+	Symlinks bool
+
+	// SkipModes and SkipTimes disable restoring the permission bits and
+	// modification times of the entries.
+	SkipModes bool
+	SkipTimes bool
+}
+
+// Extract writes the contents of the archive into the directory dir,
+// which is created if needed.
+//
+// Entry names must be relative paths that stay inside dir, and entries
+// are never written through symbolic links, whether they come from the
+// archive or already exist in dir. Violations return an *fs.PathError
+// wrapping ErrInsecurePath, and exceeding a limit in opts one wrapping
+// ErrLimit. Extraction stops at the first error, leaving the entries
+// written so far in place.
+//
+// Unless disabled in opts, permission bits and modification times are
+// restored. Setuid, setgid and sticky bits are never restored. Otherwise,
+// for entries that record no permission bits, such as those of unknown
+// creators, and for directories only implied by the names of other
+// entries, the permission bits are those of os.Create and os.MkdirAll,
+// filtered by the umask.
+func (z *Reader) Extract(dir string, opts *ExtractOptions) error {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+	if opts.MaxFiles > 0 && len(z.File) > opts.MaxFiles {
+		return &fs.PathError{Op: "extract", Path: dir, Err: ErrLimit}
+	}
+	if opts.MaxTotalSize > 0 {
+		var total uint64
+		for _, f := range z.File {
+			total += f.UncompressedSize64
+			if total > uint64(opts.MaxTotalSize) {
+				return &fs.PathError{Op: "extract", Path: f.Name, Err: ErrLimit}
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	e := &archive.Extractor{
+		Dir:             dir,
+		Symlinks:        opts.Symlinks,
+		MaxTotalSize:    opts.MaxTotalSize,
+		MaxRatio:        opts.MaxRatio,
+		SkipModes:       opts.SkipModes,
+		SkipTimes:       opts.SkipTimes,
+		ErrInsecurePath: ErrInsecurePath,
+		ErrLimit:        ErrLimit,
+	}
+	for _, f := range z.File {
+		if err := extract(e, f); err != nil {
+			return err
+		}
+	}
+	return e.FinishDirs()
+}
+
+func extract(e *archive.Extractor, f *File) error {
+	name, err := e.LocalName(f.Name)
+	if err != nil {
+		return err
+	}
+	if err := e.CheckParents(name); err != nil {
+		return err
+	}
+	target := e.Target(name)
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		if err := e.Mkdir(name); err != nil {
+			return err
+		}
+		e.AddDir(name, perm(f), f.ModTime())
+		return nil
+	case mode&os.ModeSymlink != 0:
+		return symlink(e, f, name, target)
+	case mode&os.ModeType != 0:
+		return &fs.PathError{Op: "extract", Path: f.Name, Err: errors.New("zip: unsupported file type")}
+	}
+
+	w, err := e.Create(f.Name, target)
+	if err != nil {
+		return err
+	}
+	rc, err := f.Open()
+	if err != nil {
+		w.Close()
+		return err
+	}
+	defer rc.Close()
+	lw := e.LimitWriter(w, f.Name, func(n int64) (int64, int64) {
+		return n, int64(f.CompressedSize64)
+	})
+	_, err = io.Copy(lw, rc)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return e.Restore(target, perm(f), f.ModTime())
+}
+
+func symlink(e *archive.Extractor, f *File, name, target string) error {
+	if !e.Symlinks {
+		return &fs.PathError{Op: "extract", Path: f.Name, Err: ErrInsecurePath}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(rc, maxLinkTarget+1))
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if len(b) > maxLinkTarget {
+		return &fs.PathError{Op: "extract", Path: f.Name, Err: ErrLimit}
+	}
+	link, err := e.CheckLink(f.Name, path.Dir(name), string(b))
+	if err != nil {
+		return err
+	}
+	if err := os.Symlink(filepath.FromSlash(link), target); err != nil {
+		return err
+	}
+	e.Written += int64(len(b))
+	return nil
+}
+
+// perm returns the permission bits to restore for f, or 0 to keep the
+// default ones: Mode reports none for unknown creators, and Unix entries
+// may be written without any.
+func perm(f *File) fs.FileMode {
+	perm := f.Mode().Perm()
+	if h := f.CreatorVersion >> 8; perm != 0 && h != creatorUnix && h != creatorMacOSX {
+		// MS-DOS attributes only tell whether a file is read-only.
+		perm &^= 0022
+	}
+	return perm
+}
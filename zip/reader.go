@@ -11,7 +11,14 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/klauspost/crc32"
 )
@@ -27,6 +34,11 @@ type Reader struct {
 	File          []*File
 	Comment       string
 	decompressors map[uint16]Decompressor
+
+	// fileList is a list of files sorted by name,
+	// for use by the Open method. RegisterNameDecoder resets it.
+	fileListOnce sync.Once
+	fileList     []fileListEntry
 }
 
 type ReadCloser struct {
@@ -40,10 +52,12 @@ type File struct {
 	zipr         io.ReaderAt
 	zipsize      int64
 	headerOffset int64
+	rawName      string // name as stored, if it may need decoding
+	rawComment   string // comment as stored, if it may need decoding
 }
 
 func (f *File) hasDataDescriptor() bool {
-	return f.Flags&0x8 != 0
+	return f.Flags&flagDataDescriptor != 0
 }
 
 // OpenReader will open the Zip file specified by name and return a ReadCloser.
@@ -136,6 +150,48 @@ func (z *Reader) decompressor(method uint16) Decompressor {
 	return dcomp
 }
 
+// RegisterNameDecoder sets the NameDecoder used to convert the names and
+// comments of files that are neither flagged as UTF-8 nor carry Info-ZIP
+// Unicode extra fields. The entries in z.File are updated immediately,
+// and the names served by Open are rebuilt from them. If dec returns an
+// error, no entries are changed and the error is returned. A nil
+// NameDecoder restores the names as stored.
+//
+// Must not be called concurrently with any use of the Files in the Reader.
+func (z *Reader) RegisterNameDecoder(dec NameDecoder) error {
+	type decoded struct{ name, comment string }
+	res := make([]decoded, len(z.File))
+	for i, f := range z.File {
+		res[i] = decoded{f.Name, f.Comment}
+		if f.rawName != "" {
+			res[i].name = f.rawName
+			if dec != nil {
+				name, err := dec([]byte(f.rawName))
+				if err != nil {
+					return err
+				}
+				res[i].name = name
+			}
+		}
+		if f.rawComment != "" {
+			res[i].comment = f.rawComment
+			if dec != nil {
+				comment, err := dec([]byte(f.rawComment))
+				if err != nil {
+					return err
+				}
+				res[i].comment = comment
+			}
+		}
+	}
+	for i, f := range z.File {
+		f.Name, f.Comment = res[i].name, res[i].comment
+	}
+	z.fileListOnce = sync.Once{}
+	z.fileList = nil
+	return nil
+}
+
 // Close closes the Zip file, rendering it unusable for I/O.
 func (rc *ReadCloser) Close() error {
 	return rc.f.Close()
@@ -156,30 +212,40 @@ func (f *File) DataOffset() (offset int64, err error) {
 
 // Open returns a ReadCloser that provides access to the File's contents.
 // Multiple files may be read concurrently.
-func (f *File) Open() (rc io.ReadCloser, err error) {
+//
+// For stored (uncompressed) files the ReadCloser also implements
+// io.Seeker and io.ReaderAt. See OpenSeekable for compressed files.
+func (f *File) Open() (io.ReadCloser, error) {
+	return f.open()
+}
+
+// open is Open, returning an fs.File for use by Reader.Open.
+// Stored files also implement io.Seeker and io.ReaderAt.
+func (f *File) open() (fs.File, error) {
 	bodyOffset, err := f.findBodyOffset()
 	if err != nil {
-		return
+		return nil, err
 	}
 	size := int64(f.CompressedSize64)
 	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
 	dcomp := f.zip.decompressor(f.Method)
 	if dcomp == nil {
-		err = ErrAlgorithm
-		return
+		return nil, ErrAlgorithm
 	}
-	rc = dcomp(r)
 	var desr io.Reader
 	if f.hasDataDescriptor() {
 		desr = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset+size, dataDescriptorLen)
 	}
-	rc = &checksumReader{
-		rc:   rc,
+	rc := &checksumReader{
+		rc:   dcomp(r),
 		hash: crc32.NewIEEE(),
 		f:    f,
 		desr: desr,
 	}
-	return
+	if f.Method == Store && f.zip.decompressors[Store] == nil {
+		return &storedReader{checksumReader: rc, sr: r}, nil
+	}
+	return rc, nil
 }
 
 type checksumReader struct {
@@ -228,6 +294,10 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 	return
 }
 
+func (r *checksumReader) Stat() (fs.FileInfo, error) {
+	return headerFileInfo{&r.f.FileHeader}, nil
+}
+
 func (r *checksumReader) Close() error { return r.rc.Close() }
 
 // findBodyOffset does the minimum work to verify the file has a header
@@ -283,6 +353,12 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 	f.Name = string(d[:filenameLen])
 	f.Extra = d[filenameLen : filenameLen+extraLen]
 	f.Comment = string(d[filenameLen+extraLen:])
+	if f.Flags&flagUTF8 == 0 {
+		// Keep the stored bytes around, so they can be decoded
+		// if no Unicode extra field overrides them.
+		f.rawName = f.Name
+		f.rawComment = f.Comment
+	}
 
 	needUSize := f.UncompressedSize == ^uint32(0)
 	needCSize := f.CompressedSize == ^uint32(0)
@@ -299,7 +375,8 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 			if int(size) > len(b) {
 				break
 			}
-			if tag == zip64ExtraId {
+			switch tag {
+			case zip64ExtraId:
 				// update directory values from the zip64 extra block.
 				// They should only be consulted if the sizes read earlier
 				// are maxed out.
@@ -327,7 +404,16 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 					}
 					f.headerOffset = int64(eb.uint64())
 				}
-				break
+			case unicodePathExtraId:
+				if name, ok := unicodeExtra(b[:size], f.rawName); ok {
+					f.Name = name
+					f.rawName = ""
+				}
+			case unicodeCommentExtraId:
+				if comment, ok := unicodeExtra(b[:size], f.rawComment); ok {
+					f.Comment = comment
+					f.rawComment = ""
+				}
 			}
 			b = b[size:]
 		}
@@ -340,6 +426,21 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 	return nil
 }
 
+// unicodeExtra parses an Info-ZIP Unicode Path or Comment extra field
+// and returns the UTF-8 value it carries. The field is only used if its
+// CRC32 matches the stored value, since otherwise the entry was renamed
+// by a tool unaware of the extra field.
+func unicodeExtra(b readBuf, stored string) (string, bool) {
+	if len(b) < 5 || b[0] != 1 { // version 1 is the only one defined
+		return "", false
+	}
+	b = b[1:]
+	if b.uint32() != crc32.ChecksumIEEE([]byte(stored)) || !utf8.Valid(b) {
+		return "", false
+	}
+	return string(b), true
+}
+
 func readDataDescriptor(r io.Reader, f *File) error {
 	var buf [dataDescriptorLen]byte
 
@@ -519,3 +620,227 @@ func (b *readBuf) uint64() uint64 {
 	*b = (*b)[8:]
 	return v
 }
+
+// A fileListEntry is a File and its cleaned name.
+// If file == nil, the fileListEntry describes a directory without metadata.
+type fileListEntry struct {
+	name  string
+	file  *File
+	isDir bool
+}
+
+type fileInfoDirEntry interface {
+	fs.FileInfo
+	fs.DirEntry
+}
+
+func (e *fileListEntry) stat() fileInfoDirEntry {
+	if e.file != nil {
+		return headerFileInfo{&e.file.FileHeader}
+	}
+	return e
+}
+
+// Only used for directories.
+func (e *fileListEntry) Name() string       { _, elem, _ := split(e.name); return elem }
+func (e *fileListEntry) Size() int64        { return 0 }
+func (e *fileListEntry) ModTime() time.Time { return time.Time{} }
+func (e *fileListEntry) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (e *fileListEntry) Type() fs.FileMode  { return fs.ModeDir }
+func (e *fileListEntry) IsDir() bool        { return true }
+func (e *fileListEntry) Sys() interface{}   { return nil }
+
+func (e *fileListEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// toValidName coerces name to be a valid name for fs.FS.Open.
+func toValidName(name string) string {
+	name = strings.Replace(name, `\`, `/`, -1)
+	p := path.Clean(name)
+	p = strings.TrimPrefix(p, "/")
+	for p == ".." || strings.HasPrefix(p, "../") {
+		p = strings.TrimPrefix(p[len(".."):], "/")
+	}
+	return p
+}
+
+func (z *Reader) initFileList() {
+	z.fileListOnce.Do(func() {
+		dirs := make(map[string]bool)
+		knownDirs := make(map[string]bool)
+		for _, file := range z.File {
+			isDir := len(file.Name) > 0 && file.Name[len(file.Name)-1] == '/'
+			name := toValidName(file.Name)
+			if name == "" || name == "." {
+				continue
+			}
+			for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+				dirs[dir] = true
+			}
+			z.fileList = append(z.fileList, fileListEntry{name: name, file: file, isDir: isDir})
+			if isDir {
+				knownDirs[name] = true
+			}
+		}
+		for dir := range dirs {
+			if !knownDirs[dir] {
+				z.fileList = append(z.fileList, fileListEntry{name: dir, isDir: true})
+			}
+		}
+
+		sort.Slice(z.fileList, func(i, j int) bool { return fileEntryLess(z.fileList[i].name, z.fileList[j].name) })
+	})
+}
+
+func fileEntryLess(x, y string) bool {
+	xdir, xelem, _ := split(x)
+	ydir, yelem, _ := split(y)
+	return xdir < ydir || xdir == ydir && xelem < yelem
+}
+
+// Open opens the named file in the ZIP archive,
+// using the semantics of fs.FS.Open:
+// paths are always slash separated, with no
+// leading / or ../ elements.
+// Directories implied by the names of the files are synthesized,
+// so they can be opened and listed even if the archive has no
+// entries for them.
+func (z *Reader) Open(name string) (fs.File, error) {
+	z.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e := z.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.isDir {
+		return &openDir{e, z.openReadDir(name), 0}, nil
+	}
+	rc, err := e.file.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return rc, nil
+}
+
+// Stat returns an fs.FileInfo describing the named file,
+// using the semantics of fs.StatFS.
+func (z *Reader) Stat(name string) (fs.FileInfo, error) {
+	z.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	e := z.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return e.stat(), nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted
+// by filename, using the semantics of fs.ReadDirFS.
+func (z *Reader) ReadDir(name string) ([]fs.DirEntry, error) {
+	z.initFileList()
+
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	e := z.openLookup(name)
+	if e == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	if !e.isDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	files := z.openReadDir(name)
+	list := make([]fs.DirEntry, len(files))
+	for i := range files {
+		list[i] = files[i].stat()
+	}
+	return list, nil
+}
+
+func split(name string) (dir, elem string, isDir bool) {
+	if len(name) > 0 && name[len(name)-1] == '/' {
+		isDir = true
+		name = name[:len(name)-1]
+	}
+	i := len(name) - 1
+	for i >= 0 && name[i] != '/' {
+		i--
+	}
+	if i < 0 {
+		return ".", name, isDir
+	}
+	return name[:i], name[i+1:], isDir
+}
+
+var dotFile = &fileListEntry{name: "./", isDir: true}
+
+func (z *Reader) openLookup(name string) *fileListEntry {
+	if name == "." {
+		return dotFile
+	}
+
+	dir, elem, _ := split(name)
+	files := z.fileList
+	i := sort.Search(len(files), func(i int) bool {
+		idir, ielem, _ := split(files[i].name)
+		return idir > dir || idir == dir && ielem >= elem
+	})
+	if i < len(files) {
+		fname := files[i].name
+		if fname == name || len(fname) == len(name)+1 && fname[len(name)] == '/' && fname[:len(name)] == name {
+			return &files[i]
+		}
+	}
+	return nil
+}
+
+func (z *Reader) openReadDir(dir string) []fileListEntry {
+	files := z.fileList
+	i := sort.Search(len(files), func(i int) bool {
+		idir, _, _ := split(files[i].name)
+		return idir >= dir
+	})
+	j := sort.Search(len(files), func(j int) bool {
+		jdir, _, _ := split(files[j].name)
+		return jdir > dir
+	})
+	return files[i:j]
+}
+
+// openDir is the fs.File returned by Open for directories.
+type openDir struct {
+	e      *fileListEntry
+	files  []fileListEntry
+	offset int
+}
+
+func (d *openDir) Close() error               { return nil }
+func (d *openDir) Stat() (fs.FileInfo, error) { return d.e.stat(), nil }
+
+func (d *openDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("is a directory")}
+}
+
+func (d *openDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	n := len(d.files) - d.offset
+	if count > 0 && n > count {
+		n = count
+	}
+	if n == 0 {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	list := make([]fs.DirEntry, n)
+	for i := range list {
+		list[i] = d.files[d.offset+i].stat()
+	}
+	d.offset += n
+	return list, nil
+}
@@ -8,13 +8,18 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -642,3 +647,363 @@ func TestIssue12449(t *testing.T) {
 		t.Errorf("Error reading the archive: %v", err)
 	}
 }
+
+func TestFS(t *testing.T) {
+	for _, test := range []struct {
+		file string
+		want []string
+	}{
+		{"testdata/unix.zip", []string{"hello", "dir/bar", "dir/empty", "readonly"}},
+		{"testdata/test.zip", []string{"test.txt", "gophercolor16x16.png"}},
+	} {
+		z, err := OpenReader(test.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fstest.TestFS(z, test.want...); err != nil {
+			t.Errorf("%s: %v", test.file, err)
+		}
+		z.Close()
+	}
+}
+
+func TestFSImpliedDirs(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, name := range []string{"a/b/c.txt", "a/d.txt", "../e.txt", "/f.txt"} {
+		if _, err := w.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	err = fs.WalkDir(z, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "a", "a/b", "a/b/c.txt", "a/d.txt", "e.txt", "f.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkDir = %q, want %q", got, want)
+	}
+	fi, err := fs.Stat(z, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() || fi.Name() != "b" {
+		t.Errorf("Stat(a/b) = %v %q, want directory b", fi.Mode(), fi.Name())
+	}
+	if _, err := z.Open("a/../a"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(a/../a) error = %v, want %v", err, fs.ErrInvalid)
+	}
+	if _, err := z.ReadDir("a/d.txt"); err == nil {
+		t.Error("ReadDir of a file succeeded")
+	}
+}
+
+func TestOpenSeekable(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, method := range []uint16{Store, Deflate} {
+		f, err := w.CreateHeader(&FileHeader{Name: fmt.Sprint(method), Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := z.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rc.(io.ReadSeeker); !ok {
+		t.Error("Open of stored file does not implement io.Seeker")
+	}
+	if _, ok := rc.(io.ReaderAt); !ok {
+		t.Error("Open of stored file does not implement io.ReaderAt")
+	}
+	rc.Close()
+
+	for _, f := range z.File {
+		r, err := f.OpenSeekable(16 << 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: ReadAll = %d bytes, %v", f.Name, len(got), err)
+		}
+		for _, off := range []int64{300000, 5, 200000, 200001, int64(len(data)) - 10, 0, 123456} {
+			if _, err := r.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			p := make([]byte, 100)
+			n, err := io.ReadFull(r, p)
+			want := data[off:]
+			if len(want) > len(p) {
+				want = want[:len(p)]
+			}
+			if !bytes.Equal(p[:n], want) {
+				t.Errorf("%s: read at %d = %q, want %q (%v)", f.Name, off, p[:n], want, err)
+			}
+			n, err = r.ReadAt(p, off/2)
+			if err != nil || !bytes.Equal(p[:n], data[off/2:off/2+int64(n)]) {
+				t.Errorf("%s: ReadAt(%d) = %d, %v", f.Name, off/2, n, err)
+			}
+		}
+		if n, err := r.Seek(-10, io.SeekEnd); err != nil || n != int64(len(data))-10 {
+			t.Errorf("%s: Seek(-10, io.SeekEnd) = %d, %v", f.Name, n, err)
+		}
+		if rest, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(rest, data[len(data)-10:]) {
+			t.Errorf("%s: read after Seek from end = %q, %v", f.Name, rest, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", f.Name, err)
+		}
+	}
+
+	// A sequential read detects a bad checksum.
+	f := *z.File[1]
+	f.CRC32++
+	r, err := f.OpenSeekable(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != ErrChecksum {
+		t.Errorf("ReadAll with bad CRC32 = %v, want %v", err, ErrChecksum)
+	}
+}
+
+type extractEntry struct {
+	Name string
+	Mode os.FileMode
+	Data string
+}
+
+func extractZip(t *testing.T, entries []extractEntry) *Reader {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, e := range entries {
+		fh := &FileHeader{Name: e.Name, Method: Deflate}
+		fh.SetMode(e.Mode)
+		fh.SetModTime(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC))
+		f, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, e.Data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return z
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	z := extractZip(t, []extractEntry{
+		{"a/", os.ModeDir | 0750, ""},
+		{"a/b/c.txt", 0640, "hello"},
+		{"a/run", 0755, "#!/bin/sh"},
+		{"a/link", os.ModeSymlink | 0777, "b/c.txt"},
+		{"up", os.ModeSymlink | 0777, "a/../a/b"},
+	})
+	if err := z.Extract(dir, &ExtractOptions{Symlinks: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Implied directories get the default mode, filtered by the umask.
+	implied := filepath.Join(t.TempDir(), "implied")
+	if err := os.Mkdir(implied, 0777); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(implied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{
+		"a":         os.ModeDir | 0750,
+		"a/b":       fi.Mode(),
+		"a/b/c.txt": 0640,
+		"a/run":     0755,
+		"a/link":    os.ModeSymlink,
+		"up":        os.ModeSymlink,
+	} {
+		fi, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := fi.Mode()
+		if got&os.ModeSymlink != 0 {
+			got = os.ModeSymlink
+		}
+		if got != want {
+			t.Errorf("%s: mode %v, want %v", name, got, want)
+		}
+		if got != os.ModeSymlink && name != "a/b" && !fi.ModTime().Equal(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: mtime %v", name, fi.ModTime())
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "a", "link"))
+	if err != nil || string(b) != "hello" {
+		t.Errorf("reading link = %q, %v", b, err)
+	}
+	if link, _ := os.Readlink(filepath.Join(dir, "up")); link != "a/b" {
+		t.Errorf("link target %q, want cleaned %q", link, "a/b")
+	}
+
+	// Without restoring modes, files get the default mode too.
+	dir = t.TempDir()
+	if err := z.Extract(dir, &ExtractOptions{Symlinks: true, SkipModes: true}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(t.TempDir(), "implied"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ffi, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]os.FileMode{"a": fi.Mode(), "a/b/c.txt": ffi.Mode()} {
+		got, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Mode() != want {
+			t.Errorf("SkipModes: %s: mode %v, want %v", name, got.Mode(), want)
+		}
+	}
+}
+
+func TestExtractUnknownCreator(t *testing.T) {
+	// Mode reports no permission bits for creators it does not know,
+	// such as Windows NTFS (10), nor for Unix entries without any.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, fh := range []*FileHeader{
+		{Name: "ntfs/", CreatorVersion: 10 << 8},
+		{Name: "ntfs/a.txt", CreatorVersion: 10 << 8},
+		{Name: "unix/", CreatorVersion: creatorUnix << 8, ExternalAttrs: msdosDir},
+		{Name: "unix/a.txt", CreatorVersion: creatorUnix << 8},
+	} {
+		f, err := w.CreateHeader(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, "hello")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	z, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := z.Extract(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"ntfs/a.txt", "unix/a.txt"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(b) != "hello" {
+			t.Errorf("reading %s = %q, %v", name, b, err)
+		}
+	}
+	for name, want := range map[string]os.FileMode{
+		"ntfs": 0700, "ntfs/a.txt": 0600,
+		"unix": 0700, "unix/a.txt": 0600,
+	} {
+		fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm()&want != want {
+			t.Errorf("%s: mode %v, want the default", name, fi.Mode())
+		}
+	}
+}
+
+func TestExtractInsecure(t *testing.T) {
+	for _, entries := range [][]extractEntry{
+		{{"../evil", 0644, ""}},
+		{{"a/../../evil", 0644, ""}},
+		{{"/evil", 0644, ""}},
+		{{`..\evil`, 0644, ""}},
+		{{"link", os.ModeSymlink | 0777, "../evil"}},
+		{{"link", os.ModeSymlink | 0777, "/etc/passwd"}},
+		{{"a/link", os.ModeSymlink | 0777, "b/../../.."}},
+		// Writing through a link pointing inside is not allowed either.
+		{{"dot", os.ModeSymlink | 0777, "."}, {"dot/escape", os.ModeSymlink | 0777, "../evil"}},
+		{{"dot", os.ModeSymlink | 0777, "."}, {"dot", 0644, "overwrite"}},
+	} {
+		z := extractZip(t, entries)
+		if err := z.Extract(t.TempDir(), &ExtractOptions{Symlinks: true}); !errors.Is(err, ErrInsecurePath) {
+			t.Errorf("%q: got error %v, want %v", entries[len(entries)-1].Name, err, ErrInsecurePath)
+		}
+	}
+
+	z := extractZip(t, []extractEntry{{"link", os.ModeSymlink | 0777, "target"}})
+	if err := z.Extract(t.TempDir(), nil); !errors.Is(err, ErrInsecurePath) {
+		t.Errorf("link without ExtractOptions.Symlinks: got error %v, want %v", err, ErrInsecurePath)
+	}
+
+	// Links already present in the target directory are not followed.
+	dir := t.TempDir()
+	if err := os.Symlink(t.TempDir(), filepath.Join(dir, "a")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	z = extractZip(t, []extractEntry{{"a/file", 0644, ""}})
+	if err := z.Extract(dir, nil); !errors.Is(err, ErrInsecurePath) {
+		t.Errorf("existing link: got error %v, want %v", err, ErrInsecurePath)
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	zeros := strings.Repeat("\x00", 2<<20)
+	z := extractZip(t, []extractEntry{{"a", 0644, "a"}, {"b", 0644, "b"}, {"zeros", 0644, zeros}})
+	for _, opts := range []*ExtractOptions{
+		{MaxFiles: 2},
+		{MaxTotalSize: 1 << 20},
+		{MaxRatio: 100},
+	} {
+		if err := z.Extract(t.TempDir(), opts); !errors.Is(err, ErrLimit) {
+			t.Errorf("%+v: got error %v, want %v", *opts, err, ErrLimit)
+		}
+	}
+	if err := z.Extract(t.TempDir(), &ExtractOptions{MaxFiles: 3, MaxTotalSize: 3 << 20, MaxRatio: 10000}); err != nil {
+		t.Errorf("within limits: %v", err)
+	}
+
+	// The limit applies to the decompressed data, not the header.
+	z.File[2].UncompressedSize64 = 10
+	if err := z.Extract(t.TempDir(), &ExtractOptions{MaxTotalSize: 1 << 20}); !errors.Is(err, ErrLimit) {
+		t.Errorf("understated size: got error %v, want %v", err, ErrLimit)
+	}
+}
@@ -23,6 +23,12 @@ type Compressor func(io.Writer) (io.WriteCloser, error)
 // when they're finished reading.
 type Decompressor func(io.Reader) io.ReadCloser
 
+// A NameDecoder converts a file name or comment stored in a legacy
+// encoding, such as CP437 or Shift-JIS, to UTF-8.
+// Decoders from golang.org/x/text/encoding can be adapted with
+// their String method.
+type NameDecoder func([]byte) (string, error)
+
 var flateWriterPool sync.Pool
 
 func newFlateWriter(w io.Writer) io.WriteCloser {
@@ -0,0 +1,244 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"errors"
+	"hash"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/crc32"
+)
+
+// A SeekableReader provides random access to the contents of a File.
+type SeekableReader interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// defaultCheckpointInterval is the checkpoint interval used by
+// OpenSeekable if none is given.
+const defaultCheckpointInterval = 1 << 20
+
+var errNegativeOffset = errors.New("zip: negative offset")
+
+// OpenSeekable returns a SeekableReader that provides access to the
+// File's contents.
+//
+// Stored files are read directly from the archive, as with Open.
+// Deflated files are decompressed on demand. While decompressing,
+// checkpoints are recorded about every interval bytes of output, so
+// seeking only needs to decompress from the closest checkpoint before
+// the new offset. Every checkpoint holds up to 32KB of history.
+// If interval <= 0, a checkpoint is recorded about every 1MB.
+//
+// The checksum is verified when the contents are read sequentially
+// through to the end.
+func (f *File) OpenSeekable(interval int64) (SeekableReader, error) {
+	switch f.Method {
+	case Store:
+		rc, err := f.open()
+		if err != nil {
+			return nil, err
+		}
+		if sr, ok := rc.(SeekableReader); ok {
+			return sr, nil
+		}
+		rc.Close()
+	case Deflate:
+		bodyOffset, err := f.findBodyOffset()
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			interval = defaultCheckpointInterval
+		}
+		return &deflateReader{
+			f:        f,
+			sr:       io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, int64(f.CompressedSize64)),
+			interval: interval,
+		}, nil
+	}
+	return nil, ErrAlgorithm
+}
+
+// storedReader is returned by Open for stored files.
+// Read verifies the checksum as long as Seek has not moved the offset.
+type storedReader struct {
+	*checksumReader
+	sr     *io.SectionReader
+	seeked bool
+}
+
+func (r *storedReader) Read(b []byte) (int, error) {
+	if r.seeked {
+		return r.sr.Read(b)
+	}
+	return r.checksumReader.Read(b)
+}
+
+func (r *storedReader) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return r.sr.Seek(offset, whence)
+	}
+	r.seeked = true
+	return r.sr.Seek(offset, whence)
+}
+
+func (r *storedReader) ReadAt(b []byte, off int64) (int, error) {
+	return r.sr.ReadAt(b, off)
+}
+
+// deflateReader is returned by OpenSeekable for deflated files.
+type deflateReader struct {
+	f        *File
+	sr       *io.SectionReader // compressed data
+	interval int64
+
+	mu   sync.Mutex
+	cps  []flate.Checkpoint // sorted by Out
+	dec  io.ReadCloser
+	pos  int64       // offset of dec in the uncompressed data
+	hash hash.Hash32 // nil unless dec started at offset 0
+	off  int64       // offset for Read and Seek
+	buf  []byte      // for skipping data
+}
+
+func (r *deflateReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, err := r.readAt(b, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *deflateReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n < len(b) && err == nil {
+		var nn int
+		nn, err = r.readAt(b[n:], off+int64(n))
+		n += nn
+	}
+	return n, err
+}
+
+func (r *deflateReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch whence {
+	default:
+		return 0, errors.New("zip: invalid whence")
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += int64(r.f.UncompressedSize64)
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *deflateReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dec == nil {
+		return nil
+	}
+	err := r.dec.Close()
+	r.dec = nil
+	return err
+}
+
+// readAt performs a single read at off, moving the decoder there first.
+func (r *deflateReader) readAt(b []byte, off int64) (int, error) {
+	size := int64(r.f.UncompressedSize64)
+	if off >= size {
+		return 0, io.EOF
+	}
+	if rem := size - off; int64(len(b)) > rem {
+		b = b[:rem]
+	}
+	if err := r.seekDecoder(off); err != nil {
+		return 0, err
+	}
+	return r.read(b)
+}
+
+// seekDecoder moves the decoder to off, starting a new one at the closest
+// checkpoint if the current decoder is past off or far behind it.
+func (r *deflateReader) seekDecoder(off int64) error {
+	var cp flate.Checkpoint
+	if i := sort.Search(len(r.cps), func(i int) bool { return r.cps[i].Out > off }); i > 0 {
+		cp = r.cps[i-1]
+	}
+	if r.dec == nil || r.pos > off || r.pos < cp.Out {
+		if r.dec != nil {
+			r.dec.Close()
+		}
+		r.dec = flate.NewReaderCheckpoint(io.NewSectionReader(r.sr, cp.In/8, r.sr.Size()-cp.In/8), cp)
+		r.dec.(flate.Checkpointer).SetCheckpoints(r.interval, r.addCheckpoint)
+		r.pos = cp.Out
+		r.hash = nil
+		if cp.Out == 0 {
+			r.hash = crc32.NewIEEE()
+		}
+	}
+	if r.pos < off && r.buf == nil {
+		r.buf = make([]byte, 32<<10)
+	}
+	for r.pos < off {
+		b := r.buf
+		if rem := off - r.pos; int64(len(b)) > rem {
+			b = b[:rem]
+		}
+		if _, err := r.read(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads from the decoder, verifying the checksum at the end if
+// the decoder has seen all of the data.
+func (r *deflateReader) read(b []byte) (int, error) {
+	n, err := r.dec.Read(b)
+	if r.hash != nil {
+		r.hash.Write(b[:n])
+	}
+	r.pos += int64(n)
+	if r.pos == int64(r.f.UncompressedSize64) {
+		if r.hash != nil && r.hash.Sum32() != r.f.CRC32 {
+			err = ErrChecksum
+		} else if err == io.EOF {
+			err = nil
+		}
+		r.hash = nil
+	} else if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		r.dec = nil
+	}
+	return n, err
+}
+
+// addCheckpoint records cp if it extends the known checkpoints.
+func (r *deflateReader) addCheckpoint(cp flate.Checkpoint) {
+	if n := len(r.cps); n > 0 && cp.Out < r.cps[n-1].Out+r.interval {
+		return
+	}
+	r.cps = append(r.cps, cp)
+}
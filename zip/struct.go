@@ -62,7 +62,13 @@ const (
 	uint32max = (1 << 32) - 1
 
 	// extra header id's
-	zip64ExtraId = 0x0001 // zip64 Extended Information Extra Field
+	zip64ExtraId          = 0x0001 // zip64 Extended Information Extra Field
+	unicodeCommentExtraId = 0x6375 // Info-ZIP Unicode Comment Extra Field
+	unicodePathExtraId    = 0x7075 // Info-ZIP Unicode Path Extra Field
+
+	// general purpose flag bits
+	flagDataDescriptor = 0x8   // sizes and crc32 follow the file data
+	flagUTF8           = 0x800 // name and comment are UTF-8 (language encoding flag)
 )
 
 // FileHeader describes a file within a zip file.
@@ -71,7 +77,14 @@ type FileHeader struct {
 	// Name is the name of the file.
 	// It must be a relative path: it must not start with a drive
 	// letter (e.g. C:) or leading slash, and only forward slashes
-	// are allowed.
+	// are allowed. Reader.Extract rejects names that do not follow
+	// these rules.
+	//
+	// When writing, the UTF-8 flag (bit 11 of Flags) is set if Name
+	// or Comment contain valid UTF-8 outside of the ASCII range.
+	// When reading, names without the flag are taken from an Info-ZIP
+	// Unicode Path extra field if present, and otherwise passed through
+	// the Reader's NameDecoder, if one is registered.
 	Name string
 
 	CreatorVersion     uint16
@@ -112,6 +125,10 @@ func (fi headerFileInfo) ModTime() time.Time { return fi.fh.ModTime() }
 func (fi headerFileInfo) Mode() os.FileMode  { return fi.fh.Mode() }
 func (fi headerFileInfo) Sys() interface{}   { return fi.fh }
 
+// headerFileInfo also implements fs.DirEntry, for fs.ReadDirFS.
+func (fi headerFileInfo) Type() os.FileMode          { return fi.Mode().Type() }
+func (fi headerFileInfo) Info() (os.FileInfo, error) { return fi, nil }
+
 // FileInfoHeader creates a partially-populated FileHeader from an
 // os.FileInfo.
 // Because os.FileInfo's Name method returns only the base name of
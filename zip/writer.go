@@ -10,6 +10,7 @@ import (
 	"errors"
 	"hash"
 	"io"
+	"unicode/utf8"
 
 	"github.com/klauspost/crc32"
 )
@@ -211,7 +212,13 @@ func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
 		return nil, errors.New("archive/zip: invalid duplicate FileHeader")
 	}
 
-	fh.Flags |= 0x8 // we will write a data descriptor
+	fh.Flags |= flagDataDescriptor // we will write a data descriptor
+
+	// Readers assume CP437 (or the system code page) unless told
+	// otherwise, so flag names that need UTF-8 to be read correctly.
+	if requireUTF8(fh.Name) || requireUTF8(fh.Comment) {
+		fh.Flags |= flagUTF8
+	}
 
 	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
 	fh.ReaderVersion = zipVersion20
@@ -356,6 +363,20 @@ func (w *fileWriter) close() error {
 	return err
 }
 
+// requireUTF8 reports whether s is valid UTF-8 containing characters
+// outside of the ASCII range, and therefore needs the UTF-8 flag.
+func requireUTF8(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
 type countWriter struct {
 	w     io.Writer
 	count int64
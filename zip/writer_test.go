@@ -10,7 +10,11 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO(adg): a more sophisticated test suite
@@ -197,3 +201,120 @@ func BenchmarkCompressedZipGarbage(b *testing.B) {
 		zw.Close()
 	}
 }
+
+func TestAddDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a/b/c.txt":   "c",
+		"a/d.go":      "package d",
+		"a/skip/e.go": "package e",
+		"f.txt":       "f",
+		"empty/":      "",
+		"x/y.bin":     "y",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0700); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("b", filepath.Join(dir, "a", "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	build := func(opts *AddOptions) ([]byte, []string) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := w.AddDir(dir, opts); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range r.File {
+			names = append(names, f.Name)
+		}
+		return buf.Bytes(), names
+	}
+
+	_, names := build(nil)
+	want := []string{"a/", "a/b/", "a/b/c.txt", "a/d.go", "a/link", "a/skip/", "a/skip/e.go", "empty/", "f.txt", "x/", "x/y.bin"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %q\nwant %q", names, want)
+	}
+
+	_, names = build(&AddOptions{Include: []string{"*.go", "x/*"}, Exclude: []string{"skip"}})
+	want = []string{"a/", "a/d.go", "x/", "x/y.bin"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("filtered: got %q\nwant %q", names, want)
+	}
+
+	_, names = build(&AddOptions{Symlinks: SymlinkFollow, Exclude: []string{"skip", "x", "empty"}})
+	want = []string{"a/", "a/b/", "a/b/c.txt", "a/d.go", "a/link/", "a/link/c.txt", "f.txt"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("follow: got %q\nwant %q", names, want)
+	}
+
+	// With fixed times and modes, the archive only depends on the contents.
+	opts := &AddOptions{
+		Method:         Deflate,
+		ModTime:        time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC),
+		NormalizeModes: true,
+	}
+	first, _ := build(opts)
+	future := time.Now().Add(time.Hour)
+	for name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.Chtimes(p, future, future)
+		if !strings.HasSuffix(name, "/") {
+			os.Chmod(p, 0640)
+		}
+	}
+	second, _ := build(opts)
+	if !bytes.Equal(first, second) {
+		t.Error("archives of the same files differ")
+	}
+
+	r, err := NewReader(bytes.NewReader(second), int64(len(second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File {
+		var want os.FileMode
+		switch f.Name {
+		case "a/link":
+			want = os.ModeSymlink | 0777
+		case "a/b/c.txt", "a/d.go", "a/skip/e.go", "f.txt", "x/y.bin":
+			want = 0644
+		default:
+			want = os.ModeDir | 0755
+		}
+		if f.Mode() != want {
+			t.Errorf("%s: mode %v, want %v", f.Name, f.Mode(), want)
+		}
+		if !f.ModTime().Equal(opts.ModTime) {
+			t.Errorf("%s: ModTime %v, want %v", f.Name, f.ModTime(), opts.ModTime)
+		}
+		if f.Name == "a/link" {
+			rc, _ := f.Open()
+			target, _ := ioutil.ReadAll(rc)
+			if string(target) != "b" {
+				t.Errorf("link target %q, want %q", target, "b")
+			}
+		}
+	}
+}
@@ -8,14 +8,18 @@ package zip
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"sort"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/klauspost/crc32"
 )
 
 func TestOver65kFiles(t *testing.T) {
@@ -296,7 +300,7 @@ func testZip64(t testing.TB, size int64) *rleBuffer {
 	if err != nil {
 		t.Fatal("opening:", err)
 	}
-	rc.(*checksumReader).hash = fakeHash32{}
+	rc.(*storedReader).hash = fakeHash32{}
 	for i := 0; i < chunks; i++ {
 		_, err := io.ReadFull(rc, chunk)
 		if err != nil {
@@ -465,3 +469,128 @@ func BenchmarkZip64Test(b *testing.B) {
 		testZip64(b, 1<<26)
 	}
 }
+
+func TestUTF8Flag(t *testing.T) {
+	var tests = []struct {
+		name, comment string
+		utf8          bool
+	}{
+		{"hello.txt", "", false},
+		{"日本語.txt", "", true},
+		{"hello.txt", "café", true},
+		{"caf\x82.txt", "", false}, // not valid UTF-8, e.g. CP437
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, test := range tests {
+		if _, err := w.CreateHeader(&FileHeader{Name: test.name, Comment: test.comment}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		f := r.File[i]
+		if got := f.Flags&flagUTF8 != 0; got != test.utf8 {
+			t.Errorf("%q: UTF-8 flag = %v, want %v", test.name, got, test.utf8)
+		}
+		if f.Name != test.name || f.Comment != test.comment {
+			t.Errorf("got %q/%q, want %q/%q", f.Name, f.Comment, test.name, test.comment)
+		}
+	}
+}
+
+func unicodePathExtra(tag uint16, stored, unicode string) []byte {
+	b := make([]byte, 9+len(unicode))
+	eb := writeBuf(b)
+	eb.uint16(tag)
+	eb.uint16(uint16(5 + len(unicode)))
+	eb[0] = 1 // version
+	eb = eb[1:]
+	eb.uint32(crc32.ChecksumIEEE([]byte(stored)))
+	copy(eb, unicode)
+	return b
+}
+
+func TestUnicodeExtra(t *testing.T) {
+	const stored = "caf\x82.txt"
+	var tests = []struct {
+		extra []byte
+		want  string
+	}{
+		{unicodePathExtra(unicodePathExtraId, stored, "café.txt"), "café.txt"},
+		{unicodePathExtra(unicodePathExtraId, "renamed.txt", "café.txt"), stored}, // crc mismatch
+		{unicodePathExtra(unicodeCommentExtraId, stored, "café.txt"), stored},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if _, err := w.CreateHeader(&FileHeader{Name: stored, Extra: test.extra}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.File[0].Name; got != test.want {
+			t.Errorf("Name = %q, want %q", got, test.want)
+		}
+		// A decoder must not override the Unicode extra field.
+		if err := r.RegisterNameDecoder(DecodeCP437); err != nil {
+			t.Fatal(err)
+		}
+		if got := r.File[0].Name; got != "café.txt" {
+			t.Errorf("decoded Name = %q, want %q", got, "café.txt")
+		}
+	}
+}
+
+func TestRegisterNameDecoder(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.CreateHeader(&FileHeader{Name: "\x82t\x82.txt", Comment: "\xe0\xe1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	// Build the file list of Open before decoding the names.
+	if _, err := fs.ReadDir(r, "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterNameDecoder(DecodeCP437); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "été.txt" || f.Comment != "αß" {
+		t.Errorf("got %q/%q, want %q/%q", f.Name, f.Comment, "été.txt", "αß")
+	}
+	if _, err := r.Open("été.txt"); err != nil {
+		t.Errorf("Open of the decoded name: %v", err)
+	}
+	errDecode := errors.New("bad name")
+	if err := r.RegisterNameDecoder(func([]byte) (string, error) { return "", errDecode }); err != errDecode {
+		t.Errorf("got error %v, want %v", err, errDecode)
+	}
+	if f.Name != "été.txt" {
+		t.Errorf("failed decode changed Name to %q", f.Name)
+	}
+	if err := r.RegisterNameDecoder(nil); err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "\x82t\x82.txt" {
+		t.Errorf("Name = %q, want name as stored", f.Name)
+	}
+}
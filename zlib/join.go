@@ -0,0 +1,153 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zlib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"io"
+
+	"github.com/klauspost/compress/checksum"
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/internal/splice"
+)
+
+var errPresetDict = errors.New("zlib: stream uses a preset dictionary")
+
+// Concat writes to w a zlib stream holding the uncompressed data of the
+// zlib streams read from rs, in order, without recompressing it. Empty
+// readers are skipped, and streams using a preset dictionary are
+// rejected. The header of the result advertises MaxWindowSize and the
+// default FLEVEL.
+//
+// The compressed data of the streams is copied as is, except that the
+// last block of all but the last stream is no longer marked final, and is
+// followed by an empty stored block to realign the next stream on a byte
+// boundary. The data of the streams is decompressed to locate their
+// blocks, and their Adler-32 is verified. The Adler-32 of the result is
+// combined from theirs.
+func Concat(w io.Writer, rs ...io.Reader) error {
+	// The header of a Writer at DefaultCompression.
+	if _, err := w.Write([]byte{0x78, 0x9c}); err != nil {
+		return err
+	}
+	j := splice.NewJoiner(w, adlerChecksum)
+	sum := uint32(1)
+	var header [2]byte
+	var trailer [4]byte
+	for _, r := range rs {
+		br := bufio.NewReader(r)
+		if err := readHeader(br, header[:]); err != nil {
+			if err == io.EOF {
+				continue
+			}
+			return err
+		}
+		s, n, err := j.Stream(br)
+		if err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(br, trailer[:]); err != nil {
+			return noEOF(err)
+		}
+		if binary.BigEndian.Uint32(trailer[:]) != s {
+			return ErrChecksum
+		}
+		sum = checksum.CombineAdler32(sum, s, n)
+	}
+	if err := j.Close(); err != nil {
+		return err
+	}
+	return writeTrailer(w, sum, 0)
+}
+
+// Split splits the zlib stream read from r into independent zlib streams
+// at its full-flush points, without recompressing it. A full-flush point
+// is a block boundary on a byte boundary, such as those written by Concat,
+// across which the data does not refer back; those written by
+// Writer.Flush usually do not qualify. Streams using a preset dictionary
+// are rejected.
+//
+// A stream is only cut once it holds at least minSize bytes of
+// uncompressed data. For every new stream, Split calls next and writes it
+// to the returned io.Writer, with the header of r. Cut streams end with
+// an empty final block. Split calls next for no stream if r is empty.
+//
+// As it must decode up to 32KB past a full-flush point to tell whether
+// the data refers back across it, Split keeps the compressed data of
+// that range in memory. The Adler-32 of r is verified.
+func Split(r io.Reader, minSize int64, next func() (io.Writer, error)) error {
+	br := bufio.NewReader(r)
+	var header [2]byte
+	if err := readHeader(br, header[:]); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	s := splice.NewSplitter(minSize, adlerChecksum, func() (io.Writer, error) {
+		w, err := next()
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(header[:])
+		return w, err
+	}, writeTrailer)
+	sum, _, err := s.Stream(br)
+	if err != nil {
+		return err
+	}
+	var trailer [4]byte
+	if _, err := io.ReadFull(br, trailer[:]); err != nil {
+		return noEOF(err)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != sum {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// readHeader reads the header of a zlib stream without a preset
+// dictionary from r into hdr. It returns io.EOF if r is empty.
+func readHeader(r flate.Reader, hdr []byte) error {
+	if _, err := io.ReadFull(r, hdr[:2]); err != nil {
+		return err
+	}
+	h := uint(hdr[0])<<8 | uint(hdr[1])
+	if hdr[0]&0x0f != zlibDeflate || h%31 != 0 {
+		return ErrHeader
+	}
+	if hdr[1]&0x20 != 0 {
+		return errPresetDict
+	}
+	return nil
+}
+
+// adlerChecksum is the checksum of zlib trailers.
+var adlerChecksum = splice.Checksum{
+	New:     func() hash.Hash32 { return adler32.New() },
+	Combine: checksum.CombineAdler32,
+}
+
+// writeTrailer writes the trailer of a stream with the given Adler-32.
+// zlib does not record the size.
+func writeTrailer(w io.Writer, sum uint32, _ int64) error {
+	var trailer [4]byte
+	// ZLIB (RFC 1950) is big-endian, unlike GZIP (RFC 1952).
+	binary.BigEndian.PutUint32(trailer[:], sum)
+	_, err := w.Write(trailer[:])
+	return err
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
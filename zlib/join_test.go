@@ -0,0 +1,154 @@
+// Copyright 2016 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zlib
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func compressLevel(t *testing.T, data []byte, level int) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// joinInputs returns parts of a text file, compressed at various levels,
+// so that their last blocks end at various bit positions.
+func joinInputs(t *testing.T) (parts [][]byte, compressed []io.Reader) {
+	data, err := ioutil.ReadFile("../testdata/Mark.Twain-Tom.Sawyer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := []int{NoCompression, BestSpeed, 2, 3, 4, DefaultCompression, 6, 7, 8, BestCompression, HuffmanOnly}
+	for i, n := 0, 1; len(data) > 0; i, n = i+1, n*3+17 {
+		if n > len(data) {
+			n = len(data)
+		}
+		parts = append(parts, data[:n])
+		compressed = append(compressed, bytes.NewReader(compressLevel(t, data[:n], levels[i%len(levels)])))
+		data = data[n:]
+	}
+	return parts, compressed
+}
+
+func decompress(t *testing.T, b []byte) []byte {
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestConcat(t *testing.T) {
+	parts, compressed := joinInputs(t)
+	compressed = append(compressed, bytes.NewReader(nil))
+	var buf bytes.Buffer
+	if err := Concat(&buf, compressed...); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decompress(t, buf.Bytes()), bytes.Join(parts, nil); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+
+	// No input.
+	buf.Reset()
+	if err := Concat(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := decompress(t, buf.Bytes()); len(got) != 0 {
+		t.Errorf("got %d bytes for no input", len(got))
+	}
+
+	// A wrong Adler-32 in a trailer.
+	buf.Reset()
+	w, _ := NewWriterLevel(&buf, BestSpeed)
+	w.Write([]byte("hello"))
+	w.Close()
+	buf.Bytes()[buf.Len()-1]++
+	if err := Concat(ioutil.Discard, bytes.NewReader(buf.Bytes())); err != ErrChecksum {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+
+	// A preset dictionary.
+	buf.Reset()
+	w, _ = NewWriterLevelDict(&buf, BestSpeed, []byte("hello"))
+	w.Write([]byte("hello"))
+	w.Close()
+	if err := Concat(ioutil.Discard, bytes.NewReader(buf.Bytes())); err != errPresetDict {
+		t.Errorf("got %v, want %v", err, errPresetDict)
+	}
+}
+
+// splitAll splits b and returns the streams written.
+func splitAll(t *testing.T, b []byte, minSize int64) []*bytes.Buffer {
+	var streams []*bytes.Buffer
+	err := Split(bytes.NewReader(b), minSize, func() (io.Writer, error) {
+		streams = append(streams, new(bytes.Buffer))
+		return streams[len(streams)-1], nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return streams
+}
+
+func TestSplit(t *testing.T) {
+	parts, compressed := joinInputs(t)
+	var joined bytes.Buffer
+	if err := Concat(&joined, compressed...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every joined stream ends at a full-flush point.
+	streams := splitAll(t, joined.Bytes(), 0)
+	if len(streams) != len(parts) {
+		t.Fatalf("got %d streams, want %d", len(streams), len(parts))
+	}
+	for i, s := range streams {
+		if got := decompress(t, s.Bytes()); !bytes.Equal(got, parts[i]) {
+			t.Errorf("stream %d: got %d bytes, want %d", i, len(got), len(parts[i]))
+		}
+	}
+
+	// With a minimum size, streams hold several parts.
+	const minSize = 100000
+	streams = splitAll(t, joined.Bytes(), minSize)
+	var got []byte
+	for i, s := range streams {
+		b := decompress(t, s.Bytes())
+		if len(b) < minSize && i < len(streams)-1 {
+			t.Errorf("stream %d: got %d bytes, want at least %d", i, len(b), minSize)
+		}
+		got = append(got, b...)
+	}
+	if len(streams) < 2 || !bytes.Equal(got, bytes.Join(parts, nil)) {
+		t.Errorf("got %d streams with %d bytes", len(streams), len(got))
+	}
+
+	if streams := splitAll(t, nil, 0); len(streams) != 0 {
+		t.Errorf("got %d streams for no input", len(streams))
+	}
+
+	// A wrong checksum.
+	b := joined.Bytes()
+	b[len(b)-1]++
+	if err := Split(bytes.NewReader(b), 0, func() (io.Writer, error) { return ioutil.Discard, nil }); err != ErrChecksum {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+}
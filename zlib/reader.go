@@ -50,6 +50,10 @@ type reader struct {
 	digest       hash.Hash32
 	err          error
 	scratch      [4]byte
+
+	dicts  map[uint32][]byte // set by NewReaderDicts
+	dict   []byte            // dictionary of the stream
+	dictID uint32
 }
 
 // Resetter resets a ReadCloser returned by NewReader or NewReaderDict to
@@ -61,6 +65,20 @@ type Resetter interface {
 	Reset(r io.Reader, dict []byte) error
 }
 
+// DictReader is implemented by the ReadClosers returned by NewReader,
+// NewReaderDict and NewReaderDicts.
+type DictReader interface {
+	// Dict returns the preset dictionary the stream refers to and its ID,
+	// or nil and 0 if it does not refer to one.
+	Dict() (dict []byte, id uint32)
+}
+
+// DictID returns the ID zlib streams use to refer to dict: its Adler-32
+// checksum.
+func DictID(dict []byte) uint32 {
+	return adler32.Checksum(dict)
+}
+
 // NewReader creates a new ReadCloser.
 // Reads from the returned ReadCloser read and decompress data from r.
 // If r does not implement io.ByteReader, the decompressor may read more
@@ -86,6 +104,26 @@ func NewReaderDict(r io.Reader, dict []byte) (io.ReadCloser, error) {
 	return z, nil
 }
 
+// NewReaderDicts is like NewReaderDict, but takes a set of dictionaries,
+// and uses the one whose DictID the compressed data refers to. If there is
+// none, NewReaderDicts returns ErrDictionary. If several dictionaries have
+// the same ID, the last one is used. Use the DictReader interface to find
+// out which dictionary the stream uses.
+//
+// The ReadCloser returned by NewReaderDicts also implements Resetter.
+// Calling Reset with a nil dictionary keeps using the set.
+func NewReaderDicts(r io.Reader, dicts [][]byte) (io.ReadCloser, error) {
+	z := &reader{dicts: make(map[uint32][]byte, len(dicts))}
+	for _, d := range dicts {
+		z.dicts[DictID(d)] = d
+	}
+	err := z.Reset(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
 func (z *reader) Read(p []byte) (int, error) {
 	if z.err != nil {
 		return 0, z.err
@@ -127,8 +165,17 @@ func (z *reader) Close() error {
 	return z.err
 }
 
+// Dict implements DictReader.
+func (z *reader) Dict() ([]byte, uint32) {
+	return z.dict, z.dictID
+}
+
 func (z *reader) Reset(r io.Reader, dict []byte) error {
-	*z = reader{decompressor: z.decompressor}
+	dicts := z.dicts
+	if dict != nil {
+		dicts = nil
+	}
+	*z = reader{decompressor: z.decompressor, dicts: dicts}
 	if fr, ok := r.(flate.Reader); ok {
 		z.r = fr
 	} else {
@@ -158,10 +205,17 @@ func (z *reader) Reset(r io.Reader, dict []byte) error {
 			return z.err
 		}
 		checksum := uint32(z.scratch[0])<<24 | uint32(z.scratch[1])<<16 | uint32(z.scratch[2])<<8 | uint32(z.scratch[3])
-		if checksum != adler32.Checksum(dict) {
+		if z.dicts != nil {
+			var ok bool
+			if dict, ok = z.dicts[checksum]; !ok {
+				z.err = ErrDictionary
+				return z.err
+			}
+		} else if checksum != adler32.Checksum(dict) {
 			z.err = ErrDictionary
 			return z.err
 		}
+		z.dict, z.dictID = dict, checksum
 	}
 
 	if z.decompressor == nil {
@@ -177,3 +177,57 @@ func TestDecompressor(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderDicts(t *testing.T) {
+	dicts := [][]byte{
+		[]byte("version 1: hello, world"),
+		[]byte("version 2: hello, gopher"),
+		[]byte("version 3: hello, zlib"),
+	}
+	compress := func(dict []byte) []byte {
+		var b bytes.Buffer
+		w, err := NewWriterLevelDict(&b, DefaultCompression, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("hello, gopher and hello, world"))
+		w.Close()
+		return b.Bytes()
+	}
+
+	var zr io.ReadCloser
+	for _, want := range [][]byte{dicts[1], dicts[0], nil, dicts[2]} {
+		var err error
+		if zr == nil {
+			zr, err = NewReaderDicts(bytes.NewReader(compress(want)), dicts)
+		} else {
+			err = zr.(Resetter).Reset(bytes.NewReader(compress(want)), nil)
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", want, err)
+		}
+		var b bytes.Buffer
+		if _, err := io.Copy(&b, zr); err != nil {
+			t.Fatalf("%q: %v", want, err)
+		}
+		if b.String() != "hello, gopher and hello, world" {
+			t.Errorf("%q: got %q", want, b.String())
+		}
+		dict, id := zr.(DictReader).Dict()
+		wantID := uint32(0)
+		if want != nil {
+			wantID = DictID(want)
+		}
+		if !bytes.Equal(dict, want) || id != wantID {
+			t.Errorf("got dictionary %q, %#x, want %q, %#x", dict, id, want, wantID)
+		}
+	}
+
+	// A dictionary passed to Reset replaces the set.
+	if err := zr.(Resetter).Reset(bytes.NewReader(compress(dicts[1])), dicts[0]); err != ErrDictionary {
+		t.Errorf("Reset with another dictionary: got %v, want %v", err, ErrDictionary)
+	}
+	if _, err := NewReaderDicts(bytes.NewReader(compress([]byte("unknown"))), dicts); err != ErrDictionary {
+		t.Errorf("unknown dictionary: got %v, want %v", err, ErrDictionary)
+	}
+}
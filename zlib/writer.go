@@ -5,6 +5,7 @@
 package zlib
 
 import (
+	"errors"
 	"fmt"
 	"hash"
 	"hash/adler32"
@@ -24,12 +25,23 @@ const (
 	HuffmanOnly         = flate.HuffmanOnly
 )
 
+const (
+	// MinWindowSize and MaxWindowSize are the smallest and largest window
+	// sizes a zlib header can advertise.
+	MinWindowSize = 1 << 8
+	MaxWindowSize = 1 << 15
+)
+
+var errHeaderWritten = errors.New("zlib: header already written")
+
 // A Writer takes data written to it and writes the compressed
 // form of that data to an underlying writer (see NewWriter).
 type Writer struct {
 	w           io.Writer
 	level       int
 	dict        []byte
+	window      int // window size; 0 means MaxWindowSize
+	flevel      int // FLEVEL header bits; -1 means derived from level
 	compressor  *flate.Writer
 	digest      hash.Hash32
 	err         error
@@ -67,21 +79,87 @@ func NewWriterLevelDict(w io.Writer, level int, dict []byte) (*Writer, error) {
 		return nil, fmt.Errorf("zlib: invalid compression level: %d", level)
 	}
 	return &Writer{
-		w:     w,
-		level: level,
-		dict:  dict,
+		w:      w,
+		level:  level,
+		dict:   dict,
+		flevel: -1,
 	}, nil
 }
 
+// SetWindowSize sets the window size advertised in the header, which
+// decoders may use to size their buffers. It must be a power of two
+// between MinWindowSize and MaxWindowSize, and defaults to MaxWindowSize.
+// The compressor makes no back references beyond the window, so smaller
+// windows trade compression for decoder memory.
+//
+// SetWindowSize must be called before the first Write, Flush or Close.
+// The setting is kept by Reset.
+func (z *Writer) SetWindowSize(size int) error {
+	if z.wroteHeader {
+		return errHeaderWritten
+	}
+	if size < MinWindowSize || size > MaxWindowSize || size&(size-1) != 0 {
+		return fmt.Errorf("zlib: invalid window size: %d", size)
+	}
+	z.window = size
+	return nil
+}
+
+// SetFLevel sets the FLEVEL field of the header, which tells decoders how
+// the data was compressed but does not affect decompression: 0 is fastest,
+// 1 fast, 2 default and 3 best compression. With -1, the default, it is
+// derived from the compression level.
+//
+// SetFLevel must be called before the first Write, Flush or Close.
+// The setting is kept by Reset.
+func (z *Writer) SetFLevel(flevel int) error {
+	if z.wroteHeader {
+		return errHeaderWritten
+	}
+	if flevel < -1 || flevel > 3 {
+		return fmt.Errorf("zlib: invalid FLEVEL: %d", flevel)
+	}
+	z.flevel = flevel
+	return nil
+}
+
 // Reset clears the state of the Writer z such that it is equivalent to its
 // initial state from NewWriterLevel or NewWriterLevelDict, but instead writing
 // to w.
 func (z *Writer) Reset(w io.Writer) {
-	z.w = w
-	// z.level and z.dict left unchanged.
+	z.reset(w)
+}
+
+// ResetLevelDict is like Reset, but also changes the compression level and
+// the dictionary, which may be nil. The window size and FLEVEL settings
+// are kept. The compressor is reused, using flate.Writer.ResetLevelDict.
+//
+// The error returned will be nil if the level is valid, and the Writer is
+// left unchanged otherwise.
+func (z *Writer) ResetLevelDict(w io.Writer, level int, dict []byte) error {
+	if level < HuffmanOnly || level > BestCompression {
+		return fmt.Errorf("zlib: invalid compression level: %d", level)
+	}
+	z.level = level
+	z.dict = dict
 	if z.compressor != nil {
-		z.compressor.Reset(w)
+		// The level is valid, so this cannot fail.
+		z.compressor.ResetLevelDict(w, level, dict)
 	}
+	z.resetState(w)
+	return nil
+}
+
+func (z *Writer) reset(w io.Writer) {
+	// z.level, z.dict, z.window and z.flevel left unchanged.
+	if z.compressor != nil {
+		z.compressor.ResetDict(w, z.dict)
+	}
+	z.resetState(w)
+}
+
+func (z *Writer) resetState(w io.Writer) {
+	z.w = w
 	if z.digest != nil {
 		z.digest.Reset()
 	}
@@ -94,21 +172,31 @@ func (z *Writer) Reset(w io.Writer) {
 func (z *Writer) writeHeader() (err error) {
 	z.wroteHeader = true
 	// ZLIB has a two-byte header (as documented in RFC 1950).
-	// The first four bits is the CINFO (compression info), which is 7 for the default deflate window size.
+	// The first four bits is the CINFO (compression info), the base-2 logarithm
+	// of the window size minus eight, which is 7 for the default deflate window size.
 	// The next four bits is the CM (compression method), which is 8 for deflate.
 	z.scratch[0] = 0x78
+	if z.window != 0 {
+		cinfo := uint8(0)
+		for MinWindowSize<<cinfo < z.window {
+			cinfo++
+		}
+		z.scratch[0] = cinfo<<4 | 8
+	}
 	// The next two bits is the FLEVEL (compression level). The four values are:
 	// 0=fastest, 1=fast, 2=default, 3=best.
 	// The next bit, FDICT, is set if a dictionary is given.
 	// The final five FCHECK bits form a mod-31 checksum.
-	switch z.level {
-	case -2, 0, 1:
+	switch {
+	case z.flevel >= 0:
+		z.scratch[1] = uint8(z.flevel) << 6
+	case z.level == -2, z.level == 0, z.level == 1:
 		z.scratch[1] = 0 << 6
-	case 2, 3, 4, 5:
+	case 2 <= z.level && z.level <= 5:
 		z.scratch[1] = 1 << 6
-	case 6, -1:
+	case z.level == 6, z.level == -1:
 		z.scratch[1] = 2 << 6
-	case 7, 8, 9:
+	case 7 <= z.level && z.level <= 9:
 		z.scratch[1] = 3 << 6
 	default:
 		panic("unreachable")
@@ -140,7 +228,11 @@ func (z *Writer) writeHeader() (err error) {
 		}
 		z.digest = adler32.New()
 	}
-	return nil
+	window := z.window
+	if window == 0 {
+		window = MaxWindowSize
+	}
+	return z.compressor.SetWindowSize(window)
 }
 
 // Write writes a compressed form of p to the underlying io.Writer. The
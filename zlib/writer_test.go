@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"testing"
 )
@@ -210,3 +211,142 @@ func TestWriterDictIsUsed(t *testing.T) {
 		t.Errorf("result too large (got %d, want <= %d bytes). Is the dictionary being used?", len(output), expectedMaxSize)
 	}
 }
+
+func TestWriterHeader(t *testing.T) {
+	input := []byte("hello, world\n")
+	for _, tc := range []struct {
+		level, window, flevel int
+		cmf, flevel2          byte
+	}{
+		{DefaultCompression, 0, -1, 0x78, 2},
+		{BestSpeed, 0, -1, 0x78, 0},
+		{BestCompression, 0, -1, 0x78, 3},
+		{BestCompression, 0, 1, 0x78, 1},
+		{DefaultCompression, 256, -1, 0x08, 2},
+		{BestSpeed, 1024, 3, 0x28, 3},
+		{NoCompression, 4096, 0, 0x48, 0},
+	} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, tc.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.window != 0 {
+			if err := w.SetWindowSize(tc.window); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.SetFLevel(tc.flevel); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(input)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if b[0] != tc.cmf || b[1]>>6 != tc.flevel2 || (uint(b[0])<<8|uint(b[1]))%31 != 0 {
+			t.Errorf("%+v: got header %#x %#x", tc, b[0], b[1])
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc, err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, input) {
+			t.Errorf("%+v: roundtrip failed: %v", tc, err)
+		}
+	}
+
+	w := NewWriter(ioutil.Discard)
+	for _, size := range []int{0, 128, 1000, 1 << 16} {
+		if err := w.SetWindowSize(size); err == nil {
+			t.Errorf("window size %d: got nil error", size)
+		}
+	}
+	for _, flevel := range []int{-2, 4} {
+		if err := w.SetFLevel(flevel); err == nil {
+			t.Errorf("FLEVEL %d: got nil error", flevel)
+		}
+	}
+	w.Write(input)
+	if err := w.SetWindowSize(512); err != errHeaderWritten {
+		t.Errorf("got %v, want %v", err, errHeaderWritten)
+	}
+	if err := w.SetFLevel(0); err != errHeaderWritten {
+		t.Errorf("got %v, want %v", err, errHeaderWritten)
+	}
+}
+
+func TestWriterWindowSize(t *testing.T) {
+	// Random data repeating every 2048 bytes only compresses with back
+	// references beyond a window of 1024 bytes.
+	rnd := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(rnd)
+	in := bytes.Repeat(rnd, 64)
+	for _, window := range []int{1024, 4096} {
+		var buf bytes.Buffer
+		w, _ := NewWriterLevelDict(&buf, BestCompression, rnd[:256])
+		w.SetWindowSize(window)
+		w.Write(in)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if small := buf.Len() < len(in)/10; small != (window > len(rnd)) {
+			t.Errorf("window %d: compressed to %d bytes", window, buf.Len())
+		}
+		r, err := NewReaderDict(&buf, rnd[:256])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, in) {
+			t.Errorf("window %d: roundtrip failed: %v", window, err)
+		}
+	}
+}
+
+func TestWriterResetLevelDict(t *testing.T) {
+	b0, err := ioutil.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compress := func(w *Writer, buf *bytes.Buffer) []byte {
+		w.Write(b0)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	dict := []byte("0123456789.")
+
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, BestSpeed)
+	w.SetFLevel(3)
+	compress(w, &buf)
+	for _, tc := range []struct {
+		level int
+		dict  []byte
+	}{
+		{BestSpeed, dict},
+		{BestCompression, dict},
+		{BestCompression, nil},
+		{DefaultCompression, dict},
+		{HuffmanOnly, nil},
+	} {
+		var buf bytes.Buffer
+		if err := w.ResetLevelDict(&buf, tc.level, tc.dict); err != nil {
+			t.Fatal(err)
+		}
+		got := compress(w, &buf)
+
+		var want bytes.Buffer
+		w2, _ := NewWriterLevelDict(&want, tc.level, tc.dict)
+		w2.SetFLevel(3)
+		compress(w2, &want)
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("level %d, dict %t: output differs from a new Writer", tc.level, tc.dict != nil)
+		}
+	}
+
+	if err := w.ResetLevelDict(&buf, 10, nil); err == nil {
+		t.Error("level 10: got nil error")
+	}
+}